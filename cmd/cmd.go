@@ -1,16 +1,195 @@
 package cmd
 
-import "flag"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exit codes returned by Main
+const (
+	// ExitOK is returned when the command succeeds
+	ExitOK = 0
+	// ExitFailure is returned when the command fails while running
+	ExitFailure = 1
+	// ExitUsage is returned on unknown commands, invalid flags or missing arguments
+	ExitUsage = 2
+)
 
 type Command struct {
-	// Run runs the command. The args are the arguments after the command name.
-	Run func(cm *Command, args []string)
+	// Run runs the command. The args are the arguments left after parsing the flags.
+	Run func(cm *Command, args []string) error
 	// Name is the command name
 	Name string
 	// Short is a short description
 	Short string
 	// Long is a long message
 	Long string
+	// Examples are sample command lines, without the program name
+	Examples []string
+	// Required are the names of the flags that must be set
+	Required []string
 	// Flag is a set of flags specific to this command
 	Flag *flag.FlagSet
 }
+
+// UsageError is returned by commands called with invalid arguments
+type UsageError struct {
+	msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+// Usagef returns a UsageError with the formatted message
+func Usagef(format string, a ...interface{}) error {
+	return &UsageError{fmt.Sprintf(format, a...)}
+}
+
+var (
+	commands   []*Command
+	commandMap = make(map[string]*Command)
+)
+
+// Register adds commands to the registry, in the order they are listed by help
+func Register(cms ...*Command) {
+	for _, cm := range cms {
+		if _, ok := commandMap[cm.Name]; ok {
+			panic("cmd: command registered twice: " + cm.Name)
+		}
+		commands = append(commands, cm)
+		commandMap[cm.Name] = cm
+	}
+}
+
+// Lookup returns the registered command with the given name
+func Lookup(name string) (*Command, bool) {
+	cm, ok := commandMap[name]
+	return cm, ok
+}
+
+// Commands returns the registered commands
+func Commands() []*Command {
+	return append([]*Command(nil), commands...)
+}
+
+// Main runs the command named by the first argument and returns the exit code
+func Main(args []string) int {
+	if len(args) == 0 {
+		PrintUsage(os.Stderr)
+		return ExitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 1 {
+			PrintUsage(os.Stdout)
+			return ExitOK
+		}
+		cm, ok := Lookup(args[1])
+		if !ok {
+			log.Printf("error: unknown command: (%v)\n", args[1])
+			return ExitUsage
+		}
+		cm.PrintHelp(os.Stdout)
+		return ExitOK
+	}
+	cm, ok := Lookup(args[0])
+	if !ok {
+		log.Printf("error: unknown command: (%v)\n\n", args[0])
+		PrintUsage(os.Stderr)
+		return ExitUsage
+	}
+	return cm.Execute(args[1:])
+}
+
+// Execute parses the flags of the command, checks the required ones
+// and runs it, returning the exit code
+func (cm *Command) Execute(args []string) int {
+	cm.Flag.SetOutput(ioutil.Discard)
+	err := cm.Flag.Parse(args)
+	cm.Flag.SetOutput(nil)
+	if err == flag.ErrHelp {
+		cm.PrintHelp(os.Stdout)
+		return ExitOK
+	}
+	if err == nil {
+		err = cm.checkRequired()
+	}
+	if err == nil {
+		if err = cm.Run(cm, cm.Flag.Args()); err == nil {
+			return ExitOK
+		}
+		var uerr *UsageError
+		if !errors.As(err, &uerr) {
+			log.Printf("error: %v\n", err)
+			return ExitFailure
+		}
+	}
+	log.Printf("error: %v\n\n", err)
+	cm.PrintHelp(os.Stderr)
+	return ExitUsage
+}
+
+func (cm *Command) checkRequired() error {
+	set := make(map[string]bool)
+	cm.Flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var missing []string
+	for _, name := range cm.Required {
+		if !set[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) != 0 {
+		return Usagef("missing required flags: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// PrintHelp writes the usage line, long description, examples and flags of the command
+func (cm *Command) PrintHelp(w io.Writer) {
+	fmt.Fprintf(w, "Usage:\n\n\t%s %s [options]\n\n", progName(), cm.Name)
+	if len(cm.Long) != 0 {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(cm.Long))
+	} else {
+		fmt.Fprintf(w, "%s\n\n", cm.Short)
+	}
+	if len(cm.Examples) != 0 {
+		fmt.Fprintf(w, "Examples:\n\n")
+		for _, ex := range cm.Examples {
+			fmt.Fprintf(w, "\t%s %s\n", progName(), ex)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Options:\n\n")
+	cm.Flag.SetOutput(w)
+	cm.Flag.PrintDefaults()
+	cm.Flag.SetOutput(nil)
+	if len(cm.Required) != 0 {
+		fmt.Fprintf(w, "\nRequired: -%s\n", strings.Join(cm.Required, ", -"))
+	}
+}
+
+// PrintUsage writes the list of registered commands
+func PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage:\n\n")
+	fmt.Fprintf(w, "\t%s <command> [options]\n\n", progName())
+	fmt.Fprintf(w, "Commands:\n\n")
+	for _, cm := range commands {
+		fmt.Fprintf(w, "\t%-10v\t%v\n", cm.Name, cm.Short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "For usage details of each command, run:\n\n")
+	fmt.Fprintf(w, "\t%s help <command>\n", progName())
+	fmt.Fprintln(w)
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	var ran bool
+	cm := &Command{Name: "test-main", Short: "test command", Required: []string{"i"}}
+	cm.Flag = flag.NewFlagSet(cm.Name, flag.ContinueOnError)
+	in := cm.Flag.String("i", "", "input file")
+	cm.Run = func(cm *Command, args []string) error {
+		ran = true
+		switch *in {
+		case "fail":
+			return errors.New("failed")
+		case "usage":
+			return Usagef("bad input")
+		}
+		return nil
+	}
+	Register(cm)
+
+	cases := []struct {
+		args []string
+		code int
+		ran  bool
+	}{
+		{[]string{}, ExitUsage, false},
+		{[]string{"help"}, ExitOK, false},
+		{[]string{"help", "test-main"}, ExitOK, false},
+		{[]string{"help", "unknown"}, ExitUsage, false},
+		{[]string{"unknown"}, ExitUsage, false},
+		{[]string{"test-main", "-h"}, ExitOK, false},
+		{[]string{"test-main"}, ExitUsage, false},
+		{[]string{"test-main", "-x", "a"}, ExitUsage, false},
+		{[]string{"test-main", "-i", "a"}, ExitOK, true},
+		{[]string{"test-main", "-i", "fail"}, ExitFailure, true},
+		{[]string{"test-main", "-i", "usage"}, ExitUsage, true},
+	}
+	for _, tt := range cases {
+		ran = false
+		*in = ""
+		if got := Main(tt.args); got != tt.code || ran != tt.ran {
+			t.Errorf("%v: want exit %v (ran=%v), got %v (ran=%v)", tt.args, tt.code, tt.ran, got, ran)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/britojr/bnutils/bif"
+	"github.com/britojr/lkbn/vars"
+	"github.com/britojr/utl/conv"
+)
+
+// readBif reads a bayesian network in bif format, keeping the names of the states
+func readBif(fname string) (*Model, error) {
+	b, err := bif.ParseStruct(fname)
+	if err != nil {
+		return nil, err
+	}
+	states, err := bifStates(fname)
+	if err != nil {
+		return nil, err
+	}
+	m := FromBNet(buildBNet(b))
+	for _, v := range m.Vars {
+		m.setStates(v, states[v.Name()])
+	}
+	return m, nil
+}
+
+// bifStates returns the state names of the variables declared in a bif file,
+// given in braces after the number of states: type discrete [ n ] { a, b };
+func bifStates(fname string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	for _, c := range []string{"{", "}", "[", "]", ";", ","} {
+		s = strings.Replace(s, c, " "+c+" ", -1)
+	}
+	tk := strings.Fields(s)
+	states := make(map[string][]string)
+	for i := 0; i+1 < len(tk); i++ {
+		if tk[i] != "variable" {
+			continue
+		}
+		name := tk[i+1]
+		for i < len(tk) && tk[i] != "]" {
+			i++
+		}
+		for i < len(tk) && tk[i] != "{" {
+			i++
+		}
+		var names []string
+		for i++; i < len(tk) && tk[i] != "}"; i++ {
+			if tk[i] != "," {
+				names = append(names, tk[i])
+			}
+		}
+		states[name] = names
+	}
+	return states, nil
+}
+
+// bifName replaces the characters that cannot be in a bif name
+func bifName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// bifStateNames returns the state names of v as bif names
+func bifStateNames(m *Model, v *vars.Var) []string {
+	names := make([]string, v.NState())
+	for i, name := range m.stateNames(v) {
+		names[i] = bifName(name)
+	}
+	return names
+}
+
+// writeBif writes a bayesian network in bif format, with a line of the
+// conditional distribution of the child for each state of the parents
+func writeBif(m *Model, fname string, opt Options) error {
+	if err := m.orient(); err != nil {
+		return fmt.Errorf("%v: %v", fname, err)
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	name := m.Name
+	if len(name) == 0 {
+		name = "unknown"
+	}
+	fmt.Fprintf(w, "network %v {}\n", name)
+	for _, v := range m.Vars {
+		fmt.Fprintf(w, "variable %v {\n", v.Name())
+		fmt.Fprintf(w, "  type discrete [ %v ] { %v };\n", v.NState(), strings.Join(bifStateNames(m, v), ", "))
+		fmt.Fprintf(w, "}\n")
+	}
+	for i, fc := range m.Factors {
+		x := m.Child[i]
+		pavs := fc.Variables().Diff(vars.VarList{x})
+		if len(pavs) == 0 {
+			fmt.Fprintf(w, "probability ( %v ) {\n", x.Name())
+			fmt.Fprintf(w, "  table %v;\n", bifValues(fc.Values()))
+			fmt.Fprintf(w, "}\n")
+			continue
+		}
+		fmt.Fprintf(w, "probability ( %v | %v ) {\n", x.Name(), strings.Join(varNames(pavs), ", "))
+		ixf := vars.NewIndexFor(pavs, pavs)
+		for !ixf.Ended() {
+			attrbMap := ixf.Attribution()
+			attrbStr := make([]string, 0, len(attrbMap))
+			for _, v := range pavs {
+				attrbStr = append(attrbStr, bifStateNames(m, v)[attrbMap[v.ID()]])
+			}
+			p := fc.Copy()
+			p.Reduce(attrbMap).SumOut(pavs...)
+			fmt.Fprintf(w, "  (%v) %v;\n", strings.Join(attrbStr, ", "), bifValues(p.Values()))
+			ixf.Next()
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func bifValues(values []float64) string {
+	return strings.Replace(strings.Join(conv.Sftoa(values), ", "), "E+00", "", -1)
+}
@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CacheDir is the directory where converted models are kept between runs,
+// it can be set with the EXPRUN_CACHE environment variable
+var CacheDir = defaultCacheDir()
+
+func defaultCacheDir() string {
+	if dir := os.Getenv("EXPRUN_CACHE"); len(dir) != 0 {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "exp-run")
+	}
+	return filepath.Join(os.TempDir(), "exp-run")
+}
+
+// Cached returns the name of the conversion of src in the cache directory,
+// the file is keyed by the contents of src and the conversion parameters
+// and is only converted if no previous run did the same conversion
+func Cached(src, convType string, opt Options) (string, error) {
+	key, err := cacheKey(src, convType, opt)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(CacheDir, key+"."+convType[strings.Index(convType, "2")+1:])
+	if _, err := os.Stat(dst); err == nil {
+		return dst, nil
+	}
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return "", err
+	}
+	// convert to a temporary file and rename it so concurrent runs never see partial files
+	tmp, err := ioutil.TempFile(CacheDir, key+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := Convert(src, tmp.Name(), convType, "", "", opt); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp.Name(), dst)
+}
+
+// cacheVersion is hashed into the cache keys, bump it whenever a writer changes
+// its output so files converted by previous versions are not reused
+const cacheVersion = 3
+
+func cacheKey(src, convType string, opt Options) (string, error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "\x00%v\x00%v\x00%v\x00%v", cacheVersion, convType, opt.Smooth, opt.UAIType)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
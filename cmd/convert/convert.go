@@ -6,7 +6,9 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 
@@ -15,9 +17,6 @@ import (
 	"github.com/britojr/lkbn/factor"
 	"github.com/britojr/lkbn/model"
 	"github.com/britojr/lkbn/vars"
-	"github.com/britojr/utl/conv"
-	"github.com/britojr/utl/errchk"
-	"github.com/britojr/utl/ioutl"
 )
 
 // conversion types
@@ -35,8 +34,27 @@ const (
 	Mo2mar   = "mo2mar"
 )
 
+// data conversions, that do not go through a model
+var dataConvs = []string{Ev2evid, Csv2arff, Mo2mar}
+
+// ltmFormat is the bif written by the BI tool for latent tree models,
+// only read by conversion type since it needs the header of the observed variables
+const ltmFormat = "bi"
+
+// ConvTypes returns the conversions between the registered model formats and the data conversions
 func ConvTypes() []string {
-	return []string{Bi2bif, Bi2xml, Xml2bif, Xml2uai, Bif2xml, Bif2fg, Bif2uai, Ev2evid, Csv2arff, Mo2mar}
+	var types []string
+	for _, in := range append([]string{ltmFormat}, Formats()...) {
+		if in != ltmFormat && formats[in].Read == nil {
+			continue
+		}
+		for _, out := range Formats() {
+			if formats[out].Write != nil {
+				types = append(types, in+"2"+out)
+			}
+		}
+	}
+	return append(types, dataConvs...)
 }
 
 var Cmd = &cmd.Command{}
@@ -44,69 +62,126 @@ var Cmd = &cmd.Command{}
 func init() {
 	Cmd.Name = "convert"
 	Cmd.Short = "converts between different types of models"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		src := cm.Flag.String("i", "", "input file")
-		dst := cm.Flag.String("o", "", "output file")
-		hdrname := cm.Flag.String("h", "", "header/schema file")
-		bname := cm.Flag.String("b", "", "bnet bif file")
-		smooth := cm.Flag.Float64("smooth", 0.0, "smooth deterministic probs")
-		convType := cm.Flag.String("t", "", "conversion type ("+strings.Join(ConvTypes(), "|")+")")
-		cm.Flag.Parse(args)
-		if len(*src) == 0 || len(*dst) == 0 || len(*convType) == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
+	Cmd.Long = `
+Convert reads a model or data file and writes it in another format.
+Models are read into a common representation and written by the format of the
+output, so any model format read (` + strings.Join(readFormats(), ", ") + `) can be written
+in any other (` + strings.Join(writeFormats(), ", ") + `). Without a conversion type the
+formats are given by the file extensions, the type names the input and output
+formats (bif2uai, xml2fg, ...) and is needed for data conversions and for
+files with other extensions.
+Uai BAYES files are read as bayesian networks and MARKOV files as undirected
+models, which are written in the directed formats (bif, xml) if their factors
+are the conditional distributions of a bayesian network. Bayesian networks are
+written in uai BAYES files, with the child last in each scope, unless -uai-type
+is markov.
+The state names of bif and Hugin net files are kept in the bif, net and xml
+outputs, other formats have generated names.
+The header/schema file is used by the data conversions and by bi2bif/bi2xml
+to name the observed variables.`
+	Cmd.Examples = []string{
+		"convert -i asia.bif -o asia.uai",
+		"convert -i asia.xml -o asia.fg",
+		"convert -i asia.net -o asia.bif",
+		"convert -t bif2uai -i asia.bif -o asia.uai -smooth 1e-6",
+		"convert -i asia.bif -o asia.uai -uai-type markov",
+		"convert -t csv2arff -i asia.train -o asia.arff -h asia.hdr",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	src := Cmd.Flag.String("i", "", "input file")
+	dst := Cmd.Flag.String("o", "", "output file")
+	hdrname := Cmd.Flag.String("h", "", "header/schema file")
+	bname := Cmd.Flag.String("b", "", "bnet bif file")
+	var opt Options
+	Cmd.Flag.Float64Var(&opt.Smooth, "smooth", 0.0, "smooth deterministic probs")
+	Cmd.Flag.StringVar(&opt.UAIType, "uai-type", "", "uai file type {"+UAIBayes+"|"+UAIMarkov+"} (default bayes for bayesian networks)")
+	convType := Cmd.Flag.String("t", "", "conversion type ("+strings.Join(ConvTypes(), "|")+"), by default given by the file extensions")
+	Cmd.Required = []string{"i", "o"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if len(opt.UAIType) != 0 && opt.UAIType != UAIBayes && opt.UAIType != UAIMarkov {
+			return cmd.Usagef("invalid uai type: (%v)", opt.UAIType)
 		}
-		Convert(*src, *dst, *convType, *hdrname, *bname, *smooth)
+		return Convert(*src, *dst, *convType, *hdrname, *bname, opt)
 	}
 }
 
-func Convert(src, dst, convType, hdrname, bname string, smooth float64) {
+// Convert converts src to dst, with the conversion type given by the file extensions if empty
+func Convert(src, dst, convType, hdrname, bname string, opt Options) error {
+	if len(convType) == 0 {
+		convType = formatName(src) + "2" + formatName(dst)
+	}
 	log.Printf("converts: (%v) %v -> %v\n", convType, src, dst)
 	vs := []*vars.Var{}
 	if len(hdrname) != 0 {
-		vs = ParseHeader(hdrname)
+		var err error
+		if vs, err = ParseHeader(hdrname); err != nil {
+			return err
+		}
 	}
 	switch convType {
-	case Bi2bif:
-		potentials, _ := parseLTMbif(src, vs)
-		ct := buildCTree(potentials)
-		writeBif(ct, dst)
-	case Bi2xml:
-		potentials, _ := parseLTMbif(src, vs)
-		ct := buildCTree(potentials)
-		writeXML(ct, dst)
-	case Bif2xml:
-		writeBifToXml(src, dst)
-	case Xml2bif:
-		writeXMLToBif(src, dst)
-	case Xml2uai:
-		writeXMLToUai(src, dst)
-	case Bif2fg:
-		writeBifToFG(src, dst)
-	case Bif2uai:
-		writeBifToUAI(src, dst, smooth)
 	case Ev2evid:
-		writeEvToEvid(src, dst)
+		return writeEvToEvid(src, dst)
 	case Csv2arff:
 		if len(vs) == 0 {
-			log.Printf("error: header/schema file needed\n")
-			Cmd.Flag.PrintDefaults()
-			return
+			return fmt.Errorf("header/schema file needed for %v", convType)
 		}
-		writeCsvToArff(src, dst, vs)
+		return writeCsvToArff(src, dst, vs)
 	case Mo2mar:
-		writeMoToMar(src, dst)
-	default:
-		log.Printf("error: invalid conversion option: (%v)\n\n", convType)
-		Cmd.Flag.PrintDefaults()
-		return
+		return writeMoToMar(src, dst)
+	}
+	in, out := splitConvType(convType)
+	wf, rf := formats[out], formats[in]
+	if wf == nil || wf.Write == nil || (in != ltmFormat && (rf == nil || rf.Read == nil)) {
+		return fmt.Errorf("invalid conversion option: (%v)", convType)
+	}
+	var m *Model
+	var err error
+	if in == ltmFormat {
+		var potentials []*factor.Factor
+		if potentials, _, err = parseLTMbif(src, vs); err != nil {
+			return err
+		}
+		m, err = ctreeModel(buildCTree(potentials))
+	} else {
+		m, err = rf.Read(src)
+	}
+	if err != nil {
+		return err
 	}
+	return wf.Write(m, dst, opt)
+}
+
+// splitConvType returns the input and output formats of a conversion type
+func splitConvType(convType string) (in, out string) {
+	if i := strings.Index(convType, "2"); i >= 0 {
+		return convType[:i], convType[i+1:]
+	}
+	return convType, ""
+}
+
+func readFormats() (names []string) {
+	for _, name := range Formats() {
+		if formats[name].Read != nil {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+func writeFormats() (names []string) {
+	for _, name := range Formats() {
+		if formats[name].Write != nil {
+			names = append(names, name)
+		}
+	}
+	return
 }
 
-func ParseHeader(hdrname string) (vs vars.VarList) {
-	r := ioutl.OpenFile(hdrname)
+func ParseHeader(hdrname string) (vs vars.VarList, err error) {
+	r, err := os.Open(hdrname)
+	if err != nil {
+		return nil, err
+	}
 	defer r.Close()
 	var lines [][]string
 	scanner := bufio.NewScanner(r)
@@ -116,59 +191,33 @@ func ParseHeader(hdrname string) (vs vars.VarList) {
 		}
 		lines = append(lines, strings.Split(scanner.Text(), ","))
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 	if len(lines) == 1 {
 		for i, c := range lines[0] {
-			vs.Add(vars.New(i, conv.Atoi(c), "", false))
+			n, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", hdrname, err)
+			}
+			vs.Add(vars.New(i, n, "", false))
 		}
 	} else {
 		if len(lines) > 1 {
-			for i, name := range lines[0] {
-				vs.Add(vars.New(i, conv.Atoi(lines[1][i]), name, false))
+			if len(lines[1]) < len(lines[0]) {
+				return nil, fmt.Errorf("%v: missing cardinalities", hdrname)
 			}
-		}
-	}
-	log.Printf("header: %v\n", vs)
-	return
-}
-
-func writeBif(ct *model.CTree, fname string) {
-	f := ioutl.CreateFile(fname)
-	defer f.Close()
-	fmt.Fprintf(f, "network unknown {}\n")
-	vs := ct.Variables()
-	for _, v := range vs {
-		fmt.Fprintf(f, "variable %v {\n", v.Name())
-		fmt.Fprintf(f, "  type discrete [ %v ] { %v };\n", v.NState(), strings.Join(v.States(), ", "))
-		fmt.Fprintf(f, "}\n")
-	}
-	nds := ct.Nodes()
-	for _, nd := range nds {
-		if nd.Parent() != nil {
-			xvs := nd.Variables().Diff(nd.Parent().Variables())
-			pavs := nd.Variables().Intersec(nd.Parent().Variables())
-			fmt.Fprintf(f, "probability ( %v | %v ) {\n", strings.Join(varNames(xvs), ", "), strings.Join(varNames(pavs), ", "))
-
-			ixf := vars.NewIndexFor(pavs, pavs)
-			for !ixf.Ended() {
-				attrbMap := ixf.Attribution()
-				attrbStr := make([]string, 0, len(attrbMap))
-				for _, v := range pavs {
-					attrbStr = append(attrbStr, v.States()[attrbMap[v.ID()]])
+			for i, name := range lines[0] {
+				n, err := strconv.Atoi(lines[1][i])
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", hdrname, err)
 				}
-				p := nd.Potential().Copy()
-				p.Reduce(attrbMap).SumOut(pavs...)
-				tableInd := strings.Join(attrbStr, ", ")
-				tableVal := strings.Join(conv.Sftoa(p.Values()), ", ")
-				fmt.Fprintf(f, "  (%v) %v;\n", tableInd, strings.Replace(tableVal, "E+00", "", -1))
-				ixf.Next()
+				vs.Add(vars.New(i, n, name, false))
 			}
-		} else {
-			fmt.Fprintf(f, "probability ( %v ) {\n", strings.Join(varNames(nd.Variables()), ", "))
-			tableVal := strings.Join(conv.Sftoa(nd.Potential().Values()), ", ")
-			fmt.Fprintf(f, "  table %v;\n", strings.Replace(tableVal, "E+00", "", -1))
 		}
-		fmt.Fprintf(f, "}\n")
 	}
+	log.Printf("header: %v\n", vs)
+	return vs, nil
 }
 
 func varNames(vs vars.VarList) (s []string) {
@@ -185,7 +234,7 @@ func maxID(vs vars.VarList) int {
 	return -1
 }
 
-func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList) {
+func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList, error) {
 	var (
 		pots    []*factor.Factor
 		nstate  int
@@ -193,10 +242,13 @@ func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList)
 		latent  bool
 	)
 	id := maxID(vs) + 1
-	fi := ioutl.OpenFile(fname)
+	fi, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer fi.Close()
 
-	_, err := fmt.Fscanf(fi, "%s", &w)
+	_, err = fmt.Fscanf(fi, "%s", &w)
 	for err != io.EOF {
 		if w == "variable" {
 			fmt.Fscanf(fi, "%s", &name)
@@ -210,7 +262,9 @@ func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList)
 				for strings.Index(w, "discrete") != 0 {
 					fmt.Fscanf(fi, "%s", &w)
 				}
-				nstate = conv.Atoi(strings.Trim(w[len("discrete"):], "[]"))
+				if nstate, err = strconv.Atoi(strings.Trim(w[len("discrete"):], "[]")); err != nil {
+					return nil, nil, fmt.Errorf("%v: variable %v: %v", fname, name, err)
+				}
 				vs.Add(vars.New(id, nstate, name, latent))
 				id++
 			}
@@ -238,7 +292,11 @@ func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList)
 			fmt.Fscanf(fi, "%s", &w)
 			for w != "}" {
 				w = strings.Trim(w, ";")
-				values = append(values, conv.Atof(w))
+				val, err := strconv.ParseFloat(w, 64)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%v: table of %v: %v", fname, name, err)
+				}
+				values = append(values, val)
 				fmt.Fscanf(fi, "%s", &w)
 			}
 
@@ -257,7 +315,7 @@ func parseLTMbif(fname string, vs vars.VarList) ([]*factor.Factor, vars.VarList)
 		}
 		_, err = fmt.Fscanf(fi, "%s", &w)
 	}
-	return pots, vs
+	return pots, vs, nil
 }
 
 func buildCTree(fs []*factor.Factor) *model.CTree {
@@ -317,124 +375,74 @@ func getMaxIntersec(f *factor.Factor, fs []*factor.Factor) (fi []*factor.Factor,
 	return
 }
 
-func writeXMLToBif(inFile, outFile string) {
-	xmlbn := model.ReadBNetXML(inFile).XMLStruct()
-
-	f := ioutl.CreateFile(outFile)
-	defer f.Close()
-	if len(xmlbn.Name) == 0 {
-		xmlbn.Name = "unknown"
-	}
-	fmt.Fprintf(f, "network %v {}\n", xmlbn.Name)
-	vs := vars.VarList{}
-	for i, v := range xmlbn.Variables {
-		u := vars.New(i, len(v.States), v.Name, false)
-		fmt.Fprintf(f, "variable %v {\n", u.Name())
-		fmt.Fprintf(f, "  type discrete [ %v ] { %v };\n", u.NState(), strings.Join(u.States(), ", "))
-		fmt.Fprintf(f, "}\n")
-		vs.Add(u)
-	}
-	for _, p := range xmlbn.Probs {
-		if len(p.Given) > 0 {
-			fmt.Fprintf(f, "probability ( %v | %v ) {\n", p.For[0], strings.Join(p.Given, ", "))
-			xv := vs.FindByName(p.For[0])
-			pavs := []*vars.Var{}
-			for _, name := range p.Given {
-				pavs = append(pavs, vs.FindByName(name))
-			}
-			ixf := vars.NewOrderedIndex(pavs, pavs)
-			k := 0
-			tableVals := strings.Fields(strings.Trim(p.Table, " "))
-			for !ixf.Ended() {
-				attrbMap := ixf.Attribution()
-				attrbStr := make([]string, 0, len(attrbMap))
-				for _, v := range pavs {
-					attrbStr = append(attrbStr, v.States()[attrbMap[v.ID()]])
-				}
-				tableInd := strings.Join(attrbStr, ", ")
-				tableVal := strings.Join(tableVals[k:k+xv.NState()], ", ")
-				tableVal = strings.Replace(tableVal, "E+00", "", -1)
-				fmt.Fprintf(f, "  (%v) %v;\n", tableInd, tableVal)
-				ixf.Next()
-				k += xv.NState()
-			}
-		} else {
-			fmt.Fprintf(f, "probability ( %v ) {\n", p.For[0])
-			tableVal := strings.Replace(strings.Trim(p.Table, " "), " ", ", ", -1)
-			tableVal = strings.Replace(tableVal, "E+00", "", -1)
-			fmt.Fprintf(f, "  table %v;\n", tableVal)
+// ctreeModel returns the directed model of a clique tree, where each node
+// is the distribution of its variables not in the parent node
+func ctreeModel(ct *model.CTree) (*Model, error) {
+	m := &Model{Vars: ct.Variables()}
+	for _, nd := range ct.Nodes() {
+		xvs := nd.Variables()
+		if nd.Parent() != nil {
+			xvs = xvs.Diff(nd.Parent().Variables())
 		}
-		fmt.Fprintf(f, "}\n")
+		if len(xvs) != 1 {
+			return nil, fmt.Errorf("clique tree node of %v variables %v", len(xvs), xvs)
+		}
+		m.Factors = append(m.Factors, nd.Potential())
+		m.Child = append(m.Child, xvs[0])
 	}
+	return m, nil
 }
 
-func writeXMLToUai(inFile, outFile string) {
-	ct := model.ReadCTreeXML(inFile)
-	w := ioutl.CreateFile(outFile)
-	defer w.Close()
-
-	fmt.Fprintln(w, "MARKOV")
-	fmt.Fprintf(w, "%v\n", len(ct.Variables()))
-	for _, v := range ct.Variables() {
-		fmt.Fprintf(w, "%v ", v.NState())
+// ReadBNet reads a bayesian network in any model format read by convert,
+// files with other extensions are read as bif
+func ReadBNet(fname string) (*model.BNet, error) {
+	rf := formats[formatName(fname)]
+	if rf == nil || rf.Read == nil {
+		rf = formats["bif"]
 	}
-	fmt.Fprintln(w)
-	fmt.Fprintf(w, "%v\n", len(ct.Nodes())) // num factors
-	for _, nd := range ct.Nodes() {
-		fmt.Fprintf(w, "%v\t", len(nd.Variables()))
-		for _, u := range nd.Variables() {
-			fmt.Fprintf(w, "%v ", u.ID())
-		}
-		fmt.Fprintln(w)
+	m, err := rf.Read(fname)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Fprintln(w)
-	for _, nd := range ct.Nodes() {
-		fmt.Fprintf(w, "%v\n", len(nd.Potential().Values()))
-		ixf := vars.NewOrderedIndex(nd.Variables(), nd.Variables())
-		for !ixf.Ended() {
-			fmt.Fprintf(w, "%v ", nd.Potential().Values()[ixf.I()])
-			ixf.NextRight()
-		}
-		fmt.Fprintln(w)
-		fmt.Fprintln(w)
+	bn, err := m.BNet()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fname, err)
 	}
+	return bn, nil
 }
 
-func writeXML(ct *model.CTree, fname string) {
-	f := ioutl.CreateFile(fname)
-	defer f.Close()
+func readXML(fname string) (*Model, error) {
+	if _, err := os.Stat(fname); err != nil {
+		return nil, err
+	}
+	return FromBNet(model.ReadBNetXML(fname)), nil
+}
 
-	bn := model.XMLBIF{BNetXML: ct.XMLStruct()}
+func writeXML(m *Model, fname string, opt Options) error {
+	bn, err := m.BNet()
+	if err != nil {
+		return fmt.Errorf("%v: %v", fname, err)
+	}
+	xmlbn := bn.XMLStruct()
+	for i, xv := range xmlbn.Variables {
+		if v := m.Vars.FindByName(xv.Name); v != nil {
+			xmlbn.Variables[i].States = m.stateNames(v)
+		}
+	}
+	return writeXMLStruct(xmlbn, fname)
+}
 
-	data, err := xml.MarshalIndent(bn, "", "\t")
-	errchk.Check(err, "")
-	f.Write(data)
+// WriteBNetXML writes a bayesian network in xml format
+func WriteBNetXML(bn *model.BNet, fname string) error {
+	return writeXMLStruct(bn.XMLStruct(), fname)
 }
 
-func writeBifToFG(src, dst string) {
-	b, err := bif.ParseStruct(src)
-	errchk.Check(err, "")
-	w := ioutl.CreateFile(dst)
-	defer w.Close()
-	fmt.Fprintf(w, "%v\n", len(b.Variables()))
-	fmt.Fprintln(w)
-	for _, v := range b.Variables() {
-		fc := b.Factor(v.Name())
-		fmt.Fprintf(w, "%v\n", len(fc.Variables()))
-		for _, u := range fc.Variables() {
-			fmt.Fprintf(w, "%v ", u.ID())
-		}
-		fmt.Fprintln(w)
-		for _, u := range fc.Variables() {
-			fmt.Fprintf(w, "%v ", u.NState())
-		}
-		fmt.Fprintln(w)
-		fmt.Fprintf(w, "%v\n", len(fc.Values()))
-		for i, vl := range fc.Values() {
-			fmt.Fprintf(w, "%v\t%v\n", i, vl)
-		}
-		fmt.Fprintln(w)
+func writeXMLStruct(xmlbn model.BNetXML, fname string) error {
+	data, err := xml.MarshalIndent(model.XMLBIF{BNetXML: xmlbn}, "", "\t")
+	if err != nil {
+		return err
 	}
+	return ioutil.WriteFile(fname, data, 0644)
 }
 
 func buildBNet(b *bif.Struct) *model.BNet {
@@ -447,53 +455,6 @@ func buildBNet(b *bif.Struct) *model.BNet {
 	return bn
 }
 
-func writeBifToXml(src, dst string) {
-	b, err := bif.ParseStruct(src)
-	errchk.Check(err, "")
-	bn := buildBNet(b)
-	w := ioutl.CreateFile(dst)
-	defer w.Close()
-
-	xmlbn := model.XMLBIF{BNetXML: bn.XMLStruct()}
-	data, err := xml.MarshalIndent(xmlbn, "", "\t")
-	errchk.Check(err, "")
-	w.Write(data)
-}
-
-func writeBifToUAI(src, dst string, smooth float64) {
-	b, err := bif.ParseStruct(src)
-	errchk.Check(err, "")
-	w := ioutl.CreateFile(dst)
-	defer w.Close()
-	fmt.Fprintln(w, "MARKOV")
-	fmt.Fprintf(w, "%v\n", len(b.Variables()))
-	for _, v := range b.Variables() {
-		fmt.Fprintf(w, "%v ", v.NState())
-	}
-	fmt.Fprintln(w)
-	fmt.Fprintf(w, "%v\n", len(b.Variables())) // num factor is the same as num vars for BNs
-	for _, v := range b.Variables() {
-		fc := b.Factor(v.Name())
-		fmt.Fprintf(w, "%v\t", len(fc.Variables()))
-		for _, u := range fc.Variables() {
-			fmt.Fprintf(w, "%v ", u.ID())
-		}
-		fmt.Fprintln(w)
-	}
-	fmt.Fprintln(w)
-	for _, v := range b.Variables() {
-		fc := b.Factor(v.Name())
-		fmt.Fprintf(w, "%v\n", len(fc.Values()))
-		ixf := vars.NewOrderedIndex(fc.Variables(), fc.Variables())
-		for !ixf.Ended() {
-			fmt.Fprintf(w, "%v ", smoothValues(fc.Values(), smooth)[ixf.I()])
-			ixf.NextRight()
-		}
-		fmt.Fprintln(w)
-		fmt.Fprintln(w)
-	}
-}
-
 func smoothValues(values []float64, smooth float64) []float64 {
 	ws := append([]float64(nil), values...)
 	for i, v := range ws {
@@ -507,8 +468,11 @@ func smoothValues(values []float64, smooth float64) []float64 {
 	return ws
 }
 
-func writeEvToEvid(src, dst string) {
-	r := ioutl.OpenFile(src)
+func writeEvToEvid(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
 	defer r.Close()
 	parsed := []string{}
 	scanner := bufio.NewScanner(r)
@@ -529,15 +493,22 @@ func writeEvToEvid(src, dst string) {
 		}
 		parsed = append(parsed, pstr)
 	}
-	w := ioutl.CreateFile(dst)
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
 	defer w.Close()
 	fmt.Fprintf(w, "%v\n", len(parsed))
 	for _, line := range parsed {
 		fmt.Fprintf(w, "%v\n", line)
 	}
+	return nil
 }
 
-func writeCsvToArff(src, dst string, vs vars.VarList) {
+func writeCsvToArff(src, dst string, vs vars.VarList) error {
 	hdr := "@relation data\n"
 	for _, v := range vs {
 		states := make([]string, v.NState())
@@ -549,15 +520,26 @@ func writeCsvToArff(src, dst string, vs vars.VarList) {
 	}
 	hdr += "@data"
 
-	r := ioutl.OpenFile(src)
-	w := ioutl.CreateFile(dst)
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
 	fmt.Fprintln(w, hdr)
-	_, err := io.Copy(w, r)
-	errchk.Check(err, "")
+	_, err = io.Copy(w, r)
+	return err
 }
 
-func writeMoToMar(src, dst string) {
-	r := ioutl.OpenFile(src)
+func writeMoToMar(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
 	defer r.Close()
 	var parsed [][]float64
 	scanner := bufio.NewScanner(r)
@@ -565,9 +547,22 @@ func writeMoToMar(src, dst string) {
 		if len(scanner.Text()) == 0 {
 			continue
 		}
-		parsed = append(parsed, conv.Satof(strings.Fields(scanner.Text())))
+		line := strings.Fields(scanner.Text())
+		vs := make([]float64, len(line))
+		for i, f := range line {
+			if vs[i], err = strconv.ParseFloat(f, 64); err != nil {
+				return fmt.Errorf("%v: %v", src, err)
+			}
+		}
+		parsed = append(parsed, vs)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
 	}
-	w := ioutl.CreateFile(dst)
 	defer w.Close()
 	fmt.Fprintf(w, "MAR\n%v ", len(parsed))
 	for _, line := range parsed {
@@ -577,4 +572,5 @@ func writeMoToMar(src, dst string) {
 		}
 	}
 	fmt.Fprintln(w)
+	return nil
 }
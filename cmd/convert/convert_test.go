@@ -0,0 +1,91 @@
+package convert
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const asiaBif = "../examples/asia.bif"
+
+// equalModels checks that two models have the same variables and tables,
+// comparing the variable and state names if names is set
+func equalModels(t *testing.T, want, got *Model, names bool) {
+	t.Helper()
+	if len(got.Vars) != len(want.Vars) || len(got.Factors) != len(want.Factors) {
+		t.Fatalf("got %v variables and %v factors, want %v and %v",
+			len(got.Vars), len(got.Factors), len(want.Vars), len(want.Factors))
+	}
+	for i, v := range want.Vars {
+		u := got.Vars[i]
+		if u.ID() != v.ID() || u.NState() != v.NState() || (names && u.Name() != v.Name()) {
+			t.Errorf("variable %v: got %v[%v], want %v[%v]", i, u.Name(), u.NState(), v.Name(), v.NState())
+		}
+		if names && !reflect.DeepEqual(got.stateNames(u), want.stateNames(v)) {
+			t.Errorf("variable %v: states %v, want %v", v.Name(), got.stateNames(u), want.stateNames(v))
+		}
+	}
+	for i, f := range want.Factors {
+		g := got.Factors[i]
+		if got.Directed() && got.Child[i].ID() != want.Child[i].ID() {
+			t.Errorf("factor %v: child %v, want %v", i, got.Child[i], want.Child[i])
+		}
+		if !g.Variables().Equal(f.Variables()) {
+			t.Errorf("factor %v: scope %v, want %v", i, g.Variables(), f.Variables())
+			continue
+		}
+		for j, x := range f.Values() {
+			if math.Abs(g.Values()[j]-x) > 1e-9 {
+				t.Errorf("factor %v: values %v, want %v", i, g.Values(), f.Values())
+				break
+			}
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	want, err := ReadModel(asiaBif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !want.Directed() {
+		t.Fatalf("bif model is not directed")
+	}
+	for _, out := range []string{"asia.bif", "asia.uai", "asia.fg"} {
+		if err := Convert(asiaBif, filepath.Join(dir, out), "", "", "", Options{}); err != nil {
+			t.Errorf("%v: %v", out, err)
+		}
+	}
+	got, err := ReadModel(filepath.Join(dir, "asia.bif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalModels(t, want, got, true)
+
+	if err := Convert(asiaBif, filepath.Join(dir, "asia.out"), "", "", "", Options{}); err == nil {
+		t.Errorf("want error on unknown output format")
+	}
+	if err := Convert(asiaBif, filepath.Join(dir, "asia.txt"), Bif2uai, "", "", Options{}); err != nil {
+		t.Errorf("%v: %v", Bif2uai, err)
+	}
+}
+
+func TestConvTypes(t *testing.T) {
+	types := make(map[string]bool)
+	for _, c := range ConvTypes() {
+		types[c] = true
+	}
+	for _, c := range []string{Bi2bif, Bi2xml, Xml2bif, Xml2uai, Bif2xml, Bif2fg, Bif2uai, Ev2evid, Csv2arff, Mo2mar} {
+		if !types[c] {
+			t.Errorf("missing conversion type %v", c)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/vars"
+)
+
+// readFG reads an undirected model from a libDAI factor graph file, the variables
+// numbered in the order of their labels and named by them, each table listing the
+// nonzero values with the first variable of the factor varying fastest
+func readFG(fname string) (*Model, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	u := &uaiFields{fname: fname, fields: strings.Fields(strings.Join(lines, "\n"))}
+	nf := u.int()
+	labels := make([][]int, nf)
+	tables := make([][]float64, nf)
+	cards := make(map[int]int)
+	for i := 0; i < nf && u.err == nil; i++ {
+		n := u.int()
+		labels[i] = make([]int, n)
+		for j := range labels[i] {
+			labels[i][j] = u.int()
+		}
+		size := 1
+		for _, l := range labels[i] {
+			c := u.int()
+			if c2, ok := cards[l]; ok && c2 != c && u.err == nil {
+				return nil, fmt.Errorf("%v: factor %v: variable %v of %v states, was %v", fname, i, l, c, c2)
+			}
+			cards[l] = c
+			size *= c
+		}
+		tables[i] = make([]float64, size)
+		nz := u.int()
+		for j := 0; j < nz && u.err == nil; j++ {
+			k, x := u.int(), u.float()
+			if k >= size && u.err == nil {
+				return nil, fmt.Errorf("%v: factor %v: index %v out of %v values", fname, i, k, size)
+			}
+			if u.err == nil {
+				tables[i][k] = x
+			}
+		}
+	}
+	if u.err != nil {
+		return nil, u.err
+	}
+	sorted := make([]int, 0, len(cards))
+	for l := range cards {
+		sorted = append(sorted, l)
+	}
+	sort.Ints(sorted)
+	m := &Model{}
+	byLabel := make(map[int]*vars.Var)
+	for id, l := range sorted {
+		byLabel[l] = vars.New(id, cards[l], strconv.Itoa(l), false)
+		m.Vars = append(m.Vars, byLabel[l])
+	}
+	for i, ls := range labels {
+		var scope vars.VarList
+		seen := make(map[int]bool)
+		for _, l := range ls {
+			if seen[l] {
+				return nil, fmt.Errorf("%v: factor %v: repeated variable %v", fname, i, l)
+			}
+			seen[l] = true
+			scope = append(scope, byLabel[l])
+		}
+		m.Factors = append(m.Factors, fgFactor(scope, tables[i]))
+	}
+	return m, nil
+}
+
+// fgFactor returns the factor of a libDAI table, whose first variable varies fastest
+func fgFactor(scope vars.VarList, table []float64) *factor.Factor {
+	rev := make(vars.VarList, len(scope))
+	for i, v := range scope {
+		rev[len(scope)-1-i] = v
+	}
+	return uaiFactor(rev, table)
+}
+
+// writeFG writes a model in libDAI factor graph format, the variables labeled by
+// their ids and each table with the first variable of the factor varying fastest
+func writeFG(m *Model, fname string, opt Options) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "%v\n", len(m.Factors))
+	fmt.Fprintln(w)
+	for _, fc := range m.Factors {
+		scope := fc.Variables()
+		fmt.Fprintf(w, "%v\n", len(scope))
+		for _, u := range scope {
+			fmt.Fprintf(w, "%v ", u.ID())
+		}
+		fmt.Fprintln(w)
+		for _, u := range scope {
+			fmt.Fprintf(w, "%v ", u.NState())
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%v\n", len(fc.Values()))
+		ixf := vars.NewOrderedIndex(fc.Variables(), scope)
+		for i := 0; !ixf.Ended(); i++ {
+			fmt.Fprintf(w, "%v\t%v\n", i, fc.Values()[ixf.I()])
+			ixf.Next()
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,107 @@
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/vars"
+)
+
+// marginals returns the marginal of each variable of a model by multiplying all its factors
+func marginals(m *Model) [][]float64 {
+	joint := factor.New()
+	for _, f := range m.Factors {
+		joint = joint.Times(f)
+	}
+	mars := make([][]float64, len(m.Vars))
+	for i, v := range m.Vars {
+		g, _ := joint.Copy().SumOut(m.Vars.Diff(vars.VarList{v})...).Normalize()
+		mars[i] = g.Values()
+	}
+	return mars
+}
+
+func TestFGGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fg, bif := filepath.Join(dir, "asia.fg"), filepath.Join(dir, "asia.bif")
+	if err := Convert(asiaBif, fg, "", "", "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(fg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile("testdata/asia.fg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, golden) {
+		t.Errorf("fg of asia differs from testdata/asia.fg:\n%s", got)
+	}
+
+	want, err := ReadModel(asiaBif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Convert("testdata/asia.fg", bif, "", "", "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadModel(bif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalModels(t, want, m, false)
+	wantMars, gotMars := marginals(want), marginals(m)
+	for i := range wantMars {
+		for k := range wantMars[i] {
+			if math.Abs(wantMars[i][k]-gotMars[i][k]) > 1e-12 {
+				t.Errorf("marginal of %v: got %v, want %v", want.Vars[i].Name(), gotMars[i], wantMars[i])
+				break
+			}
+		}
+	}
+}
+
+func TestReadFG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// variable 7 of 3 states listed before variable 2, so it varies fastest
+	content := "# factor graph\n2\n\n1\n2\n2\n2\n0 0.4\n1 0.6\n\n2\n7 2\n3 2\n4\n0 1\n2 0.5\n3 1\n5 2\n"
+	m, err := readFG(writeTemp(t, dir, "a.fg", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Vars) != 2 || m.Vars[0].Name() != "2" || m.Vars[1].Name() != "7" || m.Vars[1].NState() != 3 {
+		t.Fatalf("wrong variables %v", m.Vars)
+	}
+	// in the factor variable 2 (id 0) varies fastest
+	want := []float64{1, 1, 0, 0, 0.5, 2}
+	got := m.Factors[1].Values()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("values %v, want %v", got, want)
+		}
+	}
+	for _, content := range []string{
+		"1\n\n1\n0\n2\n1\n2 0.5\n",
+		"2\n\n1\n0\n2\n0\n\n1\n0\n3\n0\n",
+		"1\n\n2\n0 0\n2 2\n0\n",
+		"1\n\n1\n0\n2\n2\n0 0.5\n",
+	} {
+		if _, err := readFG(writeTemp(t, dir, "bad.fg", content)); err == nil {
+			t.Errorf("want error reading %q", content)
+		}
+	}
+}
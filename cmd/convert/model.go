@@ -0,0 +1,219 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/model"
+	"github.com/britojr/lkbn/vars"
+)
+
+// Model is the representation of a model between the formats read and written by convert,
+// the variables have ids 0..n-1 in the order of the file and each factor is over a set
+// of them; in a directed model Child holds the variable of each factor, whose conditional
+// distribution given the other variables of the factor it is, and is nil otherwise
+type Model struct {
+	Name    string
+	Vars    vars.VarList
+	Factors []*factor.Factor
+	Child   []*vars.Var
+	// States holds the state names of each variable by id, nil for generated names
+	States [][]string
+}
+
+// stateNames returns the names of the states of v
+func (m *Model) stateNames(v *vars.Var) []string {
+	if v.ID() < len(m.States) && m.States[v.ID()] != nil {
+		return m.States[v.ID()]
+	}
+	return v.States()
+}
+
+// setStates sets the state names of v, when there is one for each state
+func (m *Model) setStates(v *vars.Var, names []string) {
+	if len(names) != v.NState() {
+		return
+	}
+	for len(m.States) <= v.ID() {
+		m.States = append(m.States, nil)
+	}
+	m.States[v.ID()] = names
+}
+
+// Directed reports whether the factors of the model are conditional distributions
+func (m *Model) Directed() bool {
+	return m.Child != nil
+}
+
+// FromBNet returns the model of a bayesian network, with one factor per variable
+func FromBNet(bn *model.BNet) *Model {
+	m := &Model{Vars: bn.Variables()}
+	for _, v := range bn.Variables() {
+		m.Factors = append(m.Factors, bn.Node(v).Potential())
+		m.Child = append(m.Child, v)
+	}
+	return m
+}
+
+// normTol is the tolerance on the sums of conditional distributions
+const normTol = 1e-6
+
+// orient makes an undirected model directed if its factors are the distributions of a
+// bayesian network: taken in topological order, each factor has a single variable not
+// in the previous ones and sums to one over it for every state of the others
+func (m *Model) orient() error {
+	if m.Directed() {
+		return nil
+	}
+	if len(m.Factors) != len(m.Vars) {
+		return fmt.Errorf("undirected model of %v factors for %v variables is not a bayesian network",
+			len(m.Factors), len(m.Vars))
+	}
+	child := make([]*vars.Var, len(m.Factors))
+	done := make(map[int]bool)
+	for n := 0; n < len(m.Factors); {
+		found := false
+		for i, f := range m.Factors {
+			if child[i] != nil {
+				continue
+			}
+			var xs vars.VarList
+			for _, v := range f.Variables() {
+				if !done[v.ID()] {
+					xs = append(xs, v)
+				}
+			}
+			if len(xs) == 1 && conditional(f, xs[0]) {
+				child[i], done[xs[0].ID()] = xs[0], true
+				found = true
+				n++
+			}
+		}
+		if !found {
+			return fmt.Errorf("undirected model is not a bayesian network")
+		}
+	}
+	m.Child = child
+	return nil
+}
+
+// conditional reports whether f sums to one over x for every state of its other variables
+func conditional(f *factor.Factor, x *vars.Var) bool {
+	stride := 1
+	for _, v := range f.Variables() {
+		if v.ID() == x.ID() {
+			break
+		}
+		stride *= v.NState()
+	}
+	values := f.Values()
+	for base := 0; base < len(values); base += stride * x.NState() {
+		for off := base; off < base+stride; off++ {
+			sum := 0.0
+			for k := 0; k < x.NState(); k++ {
+				sum += values[off+k*stride]
+			}
+			if math.Abs(sum-1) > normTol {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BNet returns the bayesian network of a model, orienting undirected models
+func (m *Model) BNet() (*model.BNet, error) {
+	if err := m.orient(); err != nil {
+		return nil, err
+	}
+	bn := model.NewBNet()
+	for i, f := range m.Factors {
+		v := m.Child[i]
+		if bn.Node(v) != nil {
+			return nil, fmt.Errorf("second table of variable %v", v.Name())
+		}
+		nd := model.NewBNode(v)
+		nd.SetPotential(f)
+		bn.AddNode(nd)
+	}
+	if len(bn.Variables()) != len(m.Vars) {
+		return nil, fmt.Errorf("%v tables for %v variables", len(m.Factors), len(m.Vars))
+	}
+	return bn, nil
+}
+
+// uai file types
+const (
+	UAIBayes  = "bayes"
+	UAIMarkov = "markov"
+)
+
+// Options of the model writers
+type Options struct {
+	// Smooth moves deterministic probabilities away from zero and one in uai files
+	Smooth float64
+	// UAIType is the type of uai files, by default bayes for directed models and markov otherwise
+	UAIType string
+}
+
+// Format reads and writes models in a file format, named by the file extension;
+// formats that are only read or only written leave the other function nil
+type Format struct {
+	Name  string
+	Read  func(fname string) (*Model, error)
+	Write func(m *Model, fname string, opt Options) error
+}
+
+// formats holds the model formats by name, starting with the built in ones
+var formats = map[string]*Format{
+	"bif": {Name: "bif", Read: readBif, Write: writeBif},
+	"xml": {Name: "xml", Read: readXML, Write: writeXML},
+	"uai": {Name: "uai", Read: readUAIModel, Write: writeUAI},
+	"fg":  {Name: "fg", Read: readFG, Write: writeFG},
+	"net": {Name: "net", Read: readNet, Write: writeNet},
+}
+
+// Register adds a model format to the conversions
+func Register(f *Format) {
+	if _, ok := formats[f.Name]; ok {
+		panic("convert: format " + f.Name + " registered twice")
+	}
+	formats[f.Name] = f
+}
+
+// Formats returns the names of the registered model formats
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatName returns the format of a file given by its extension
+func formatName(fname string) string {
+	return strings.TrimPrefix(filepath.Ext(fname), ".")
+}
+
+// ReadModel reads a model in the format given by the file extension
+func ReadModel(fname string) (*Model, error) {
+	f := formats[formatName(fname)]
+	if f == nil || f.Read == nil {
+		return nil, fmt.Errorf("%v: no reader for format (%v)", fname, formatName(fname))
+	}
+	return f.Read(fname)
+}
+
+// WriteModel writes a model in the format given by the file extension
+func WriteModel(m *Model, fname string, opt Options) error {
+	f := formats[formatName(fname)]
+	if f == nil || f.Write == nil {
+		return fmt.Errorf("%v: no writer for format (%v)", fname, formatName(fname))
+	}
+	return f.Write(m, fname, opt)
+}
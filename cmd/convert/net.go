@@ -0,0 +1,341 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/britojr/lkbn/vars"
+)
+
+// netTokens splits a Hugin net file into names, numbers, quoted strings and punctuation,
+// dropping the comments that go from % to the end of the line
+func netTokens(s string) (tk []string) {
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '%':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"':
+			j := strings.IndexByte(s[i+1:], '"')
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			tk = append(tk, s[i:i+j+2])
+			i += j + 2
+		case strings.IndexByte("(){}=;|", c) >= 0:
+			tk = append(tk, s[i:i+1])
+			i++
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && strings.IndexByte("(){}=;|%\"", s[j]) < 0 {
+				j++
+			}
+			tk = append(tk, s[i:j])
+			i = j
+		}
+	}
+	return
+}
+
+// netParser reads the tokens of a Hugin net file
+type netParser struct {
+	fname string
+	tk    []string
+	pos   int
+	err   error
+}
+
+func (p *netParser) next() string {
+	if p.pos >= len(p.tk) {
+		if p.err == nil {
+			p.err = fmt.Errorf("%v: unexpected end of file", p.fname)
+		}
+		return ""
+	}
+	p.pos++
+	return p.tk[p.pos-1]
+}
+
+func (p *netParser) expect(w string) {
+	if got := p.next(); got != w && p.err == nil {
+		p.err = fmt.Errorf("%v: token %v: found %q, want %q", p.fname, p.pos, got, w)
+	}
+}
+
+// attrs reads a block "{ name = value; ... }" and returns the tokens of each value
+func (p *netParser) attrs() map[string][]string {
+	as := make(map[string][]string)
+	p.expect("{")
+	for p.err == nil {
+		name := p.next()
+		if name == "}" {
+			break
+		}
+		p.expect("=")
+		var value []string
+		for depth := 0; p.err == nil; {
+			w := p.next()
+			if w == ";" && depth == 0 {
+				break
+			}
+			if w == "(" {
+				depth++
+			} else if w == ")" {
+				depth--
+			}
+			value = append(value, w)
+		}
+		as[name] = value
+	}
+	return as
+}
+
+// netPotential is a potential of a net file, the table of the heads given the tails
+type netPotential struct {
+	heads, tails []string
+	data         []float64
+}
+
+// readNet reads a model in Hugin net format, with the variables numbered in the order of
+// the nodes and named by their labels, or by their identifiers if the labels are missing
+// or not distinct; it is directed if each potential has a single variable before the bar
+func readNet(fname string) (*Model, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	p := &netParser{fname: fname, tk: netTokens(string(data))}
+	var names []string
+	states := make(map[string][]string)
+	labels := make(map[string]string)
+	var pots []netPotential
+	for p.pos < len(p.tk) && p.err == nil {
+		switch w := p.next(); w {
+		case "net":
+			p.attrs()
+		case "discrete":
+		case "node":
+			name := p.next()
+			as := p.attrs()
+			if _, ok := states[name]; ok && p.err == nil {
+				return nil, fmt.Errorf("%v: node %v declared twice", fname, name)
+			}
+			names = append(names, name)
+			if label := as["label"]; len(label) == 1 {
+				if l, err := strconv.Unquote(label[0]); err == nil {
+					labels[name] = l
+				} else {
+					labels[name] = strings.Trim(label[0], "\"")
+				}
+			}
+			for _, s := range as["states"] {
+				if s != "(" && s != ")" {
+					states[name] = append(states[name], strings.Trim(s, "\""))
+				}
+			}
+			if len(states[name]) == 0 && p.err == nil {
+				return nil, fmt.Errorf("%v: node %v without states", fname, name)
+			}
+		case "potential":
+			var pot netPotential
+			p.expect("(")
+			given := false
+			for w := p.next(); w != ")" && p.err == nil; w = p.next() {
+				switch {
+				case w == "|":
+					given = true
+				case given:
+					pot.tails = append(pot.tails, w)
+				default:
+					pot.heads = append(pot.heads, w)
+				}
+			}
+			for _, w := range p.attrs()["data"] {
+				if w == "(" || w == ")" {
+					continue
+				}
+				x, err := strconv.ParseFloat(w, 64)
+				if err != nil && p.err == nil {
+					p.err = fmt.Errorf("%v: potential of %v: invalid number %q", fname, pot.heads, w)
+				}
+				pot.data = append(pot.data, x)
+			}
+			pots = append(pots, pot)
+		default:
+			if p.err == nil {
+				return nil, fmt.Errorf("%v: unsupported declaration %q", fname, w)
+			}
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	useLabels, seen := true, make(map[string]bool)
+	for _, name := range names {
+		label := labels[name]
+		useLabels = useLabels && len(label) != 0 && !seen[label]
+		seen[label] = true
+	}
+	m := &Model{}
+	nodes := make(map[string]*vars.Var)
+	for id, name := range names {
+		vname := name
+		if useLabels {
+			vname = labels[name]
+		}
+		v := vars.New(id, len(states[name]), vname, false)
+		m.Vars = append(m.Vars, v)
+		m.setStates(v, states[name])
+		nodes[name] = v
+	}
+	directed := true
+	for _, pot := range pots {
+		if len(pot.heads) != 1 {
+			directed = false
+		}
+	}
+	for _, pot := range pots {
+		// the table is over the tails and then the heads, the last variable varying fastest
+		var scope vars.VarList
+		for _, name := range append(pot.tails, pot.heads...) {
+			v := nodes[name]
+			if v == nil {
+				return nil, fmt.Errorf("%v: potential of %v: unknown node %v", fname, pot.heads, name)
+			}
+			if scope.Contains(v) {
+				return nil, fmt.Errorf("%v: potential of %v: repeated node %v", fname, pot.heads, name)
+			}
+			scope = append(scope, v)
+		}
+		if len(pot.heads) == 0 || len(pot.data) != nCells(scope) {
+			return nil, fmt.Errorf("%v: potential of %v: %v values, want %v", fname, pot.heads, len(pot.data), nCells(scope))
+		}
+		m.Factors = append(m.Factors, uaiFactor(scope, pot.data))
+		if directed {
+			m.Child = append(m.Child, scope[len(scope)-1])
+		}
+	}
+	return m, nil
+}
+
+// netName returns s as a Hugin name, of letters, digits and underscores
+// not starting with a digit
+func netName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return r
+		}
+		return '_'
+	}, s)
+	if len(s) == 0 || unicode.IsDigit(rune(s[0])) {
+		s = "x" + s
+	}
+	return s
+}
+
+// netData returns a table as the nested lists of a net potential,
+// breaking the lines of the outer lists at the given column
+func netData(values []float64, cards []int, col int) string {
+	if len(cards) == 1 {
+		ws := make([]string, len(values))
+		for i, x := range values {
+			ws[i] = fmt.Sprint(x)
+		}
+		return "(" + strings.Join(ws, " ") + ")"
+	}
+	n := len(values) / cards[0]
+	parts := make([]string, cards[0])
+	for i := range parts {
+		parts[i] = netData(values[i*n:(i+1)*n], cards[1:], col+1)
+	}
+	return "(" + strings.Join(parts, "\n"+strings.Repeat(" ", col+1)) + ")"
+}
+
+// writeNet writes a model in Hugin net format, with a conditional potential of each
+// variable if the model is a bayesian network and the factors as joint potentials otherwise
+func writeNet(m *Model, fname string, opt Options) error {
+	directed := m.orient() == nil
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	idents := netIdents(m.Vars)
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "net\n{\n}\n")
+	for _, v := range m.Vars {
+		states := make([]string, v.NState())
+		for i, s := range m.stateNames(v) {
+			states[i] = strconv.Quote(s)
+		}
+		fmt.Fprintf(w, "\nnode %v\n{\n", idents[v.ID()])
+		fmt.Fprintf(w, "  label = %v;\n", strconv.Quote(v.Name()))
+		fmt.Fprintf(w, "  states = (%v);\n", strings.Join(states, " "))
+		fmt.Fprintf(w, "}\n")
+	}
+	for i, fc := range m.Factors {
+		var scope vars.VarList
+		if directed {
+			pavs := fc.Variables().Diff(vars.VarList{m.Child[i]})
+			scope = append(pavs, m.Child[i])
+			fmt.Fprintf(w, "\npotential ( %v", idents[m.Child[i].ID()])
+			if len(pavs) > 0 {
+				fmt.Fprintf(w, " | %v", netJoin(idents, pavs))
+			}
+		} else {
+			scope = fc.Variables()
+			fmt.Fprintf(w, "\npotential ( %v", netJoin(idents, scope))
+		}
+		fmt.Fprintf(w, " )\n{\n")
+		values := make([]float64, 0, len(fc.Values()))
+		cards := make([]int, len(scope))
+		for j, v := range scope {
+			cards[j] = v.NState()
+		}
+		ixf := vars.NewOrderedIndex(fc.Variables(), scope)
+		for !ixf.Ended() {
+			values = append(values, fc.Values()[ixf.I()])
+			ixf.NextRight()
+		}
+		fmt.Fprintf(w, "  data = %v;\n", netData(values, cards, len("  data = ")))
+		fmt.Fprintf(w, "}\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// netIdents returns distinct Hugin names of the variables by id, adding a numeric
+// suffix to the names of variables that map to the name of a previous one
+func netIdents(vs vars.VarList) map[int]string {
+	idents := make(map[int]string)
+	used := make(map[string]bool)
+	for _, v := range vs {
+		base := netName(v.Name())
+		name := base
+		for k := 2; used[name]; k++ {
+			name = fmt.Sprintf("%v_%v", base, k)
+		}
+		used[name] = true
+		idents[v.ID()] = name
+	}
+	return idents
+}
+
+func netJoin(idents map[int]string, vs vars.VarList) string {
+	names := make([]string, len(vs))
+	for i, v := range vs {
+		names[i] = idents[v.ID()]
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,158 @@
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/vars"
+)
+
+func TestNetRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	want, err := ReadModel(asiaBif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net, bif := filepath.Join(dir, "asia.net"), filepath.Join(dir, "asia.bif")
+	if err := Convert(asiaBif, net, "", "", "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadModel(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Directed() {
+		t.Errorf("net model is not directed")
+	}
+	for _, v := range m.Vars {
+		if !reflect.DeepEqual(m.stateNames(v), []string{"yes", "no"}) {
+			t.Errorf("states of %v: %v", v.Name(), m.stateNames(v))
+		}
+	}
+	equalModels(t, want, m, true)
+	if err := Convert(net, bif, "", "", "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadModel(bif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalModels(t, want, got, true)
+}
+
+func TestReadNet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := `% generated by hand
+net
+{
+    node_size = (80 40);
+}
+
+discrete node a
+{
+    label = "A";
+    states = ("low" "mid" "very high");
+}
+
+node b
+{
+    states = ("f" "t");
+}
+
+potential ( a ) { data = ( 0.2 0.3 0.5 ); }
+
+potential ( b | a )
+{
+    data = (( 0.1 0.9 )	% a=low
+            ( 0.4 0.6 )	% a=mid
+            ( 1 0 ));	% a=very high
+}
+`
+	m, err := readNet(writeTemp(t, dir, "a.net", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Directed() || len(m.Vars) != 2 || m.Vars[0].Name() != "a" || m.Child[1].Name() != "b" {
+		t.Fatalf("wrong model %v %v", m.Vars, m.Child)
+	}
+	if got := m.stateNames(m.Vars[0]); !reflect.DeepEqual(got, []string{"low", "mid", "very high"}) {
+		t.Errorf("states of a: %v", got)
+	}
+	// a varies fastest in the factor
+	if got, want := m.Factors[1].Values(), []float64{0.1, 0.4, 1, 0.9, 0.6, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values %v, want %v", got, want)
+	}
+	if _, err := m.BNet(); err != nil {
+		t.Error(err)
+	}
+
+	// the labels name the variables when every node has a distinct one
+	labeled := "node a { label = \"A\"; states = (\"x\" \"y\"); }\nnode b { label = \"0\"; states = (\"x\" \"y\"); }\n" +
+		"potential (a) { data = (0.5 0.5); }\npotential (b | a) { data = ((0.5 0.5) (0.5 0.5)); }\n"
+	if m, err := readNet(writeTemp(t, dir, "labeled.net", labeled)); err != nil || m.Vars[0].Name() != "A" || m.Vars[1].Name() != "0" {
+		t.Errorf("labeled nodes: %v, error %v", m, err)
+	}
+
+	// joint potentials give an undirected model
+	joint := "node a { states = (\"x\" \"y\"); }\nnode b { states = (\"x\" \"y\"); }\npotential (a b) { data = ((1 2) (3 4)); }\n"
+	if m, err := readNet(writeTemp(t, dir, "joint.net", joint)); err != nil || m.Directed() {
+		t.Errorf("joint potential: directed %v, error %v", m != nil && m.Directed(), err)
+	}
+
+	for _, content := range []string{
+		"node a { label = \"A\"; }\n",
+		"node a { states = (\"x\" \"y\"); }\npotential (a) { data = (0.5 0.3 0.2); }\n",
+		"node a { states = (\"x\" \"y\"); }\npotential (a | b) { data = ((0.5 0.5) (0.5 0.5)); }\n",
+		"node a { states = (\"x\" \"y\"); }\npotential (a) { data = (0.5 half); }\n",
+		"decision node d { states = (\"x\" \"y\"); }\n",
+		"node a { states = (\"x\" \"y\");\n",
+	} {
+		if _, err := readNet(writeTemp(t, dir, "bad.net", content)); err == nil {
+			t.Errorf("want error reading %q", content)
+		}
+	}
+}
+
+func TestNetNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the names map to the same Hugin name or are not valid Hugin names
+	a, b, c := vars.New(0, 2, "a-b", false), vars.New(1, 2, "a_b", false), vars.New(2, 2, "0", false)
+	want := &Model{
+		Vars: vars.VarList{a, b, c},
+		Factors: []*factor.Factor{
+			uaiFactor(vars.VarList{a}, []float64{0.3, 0.7}),
+			uaiFactor(vars.VarList{a, b}, []float64{0.1, 0.9, 0.6, 0.4}),
+			uaiFactor(vars.VarList{b, c}, []float64{0.5, 0.5, 0.2, 0.8}),
+		},
+		Child: []*vars.Var{a, b, c},
+	}
+	fname := filepath.Join(dir, "names.net")
+	if err := writeNet(want, fname, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readNet(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalModels(t, want, got, true)
+	idents := netIdents(want.Vars)
+	if idents[0] == idents[1] || idents[2] != "x0" {
+		t.Errorf("hugin names %v", idents)
+	}
+}
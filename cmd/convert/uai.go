@@ -0,0 +1,234 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/vars"
+)
+
+// uai preamble types
+const (
+	uaiBayes  = "BAYES"
+	uaiMarkov = "MARKOV"
+)
+
+// uaiFields reads the whitespace separated fields of a uai or fg file
+type uaiFields struct {
+	fname  string
+	fields []string
+	pos    int
+	err    error
+}
+
+func (u *uaiFields) next() string {
+	if u.pos >= len(u.fields) {
+		if u.err == nil {
+			u.err = fmt.Errorf("%v: unexpected end of file", u.fname)
+		}
+		return ""
+	}
+	u.pos++
+	return u.fields[u.pos-1]
+}
+
+func (u *uaiFields) int() int {
+	w := u.next()
+	x, err := strconv.Atoi(w)
+	if (err != nil || x < 0) && u.err == nil {
+		u.err = fmt.Errorf("%v: field %v: invalid integer %q", u.fname, u.pos, w)
+	}
+	return x
+}
+
+func (u *uaiFields) float() float64 {
+	w := u.next()
+	x, err := strconv.ParseFloat(w, 64)
+	if err != nil && u.err == nil {
+		u.err = fmt.Errorf("%v: field %v: invalid number %q", u.fname, u.pos, w)
+	}
+	return x
+}
+
+// readUAI reads the preamble type and the factors of a uai file,
+// with each scope in the order of the file
+func readUAI(fname string) (string, vars.VarList, []vars.VarList, [][]float64, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	u := &uaiFields{fname: fname, fields: strings.Fields(string(data))}
+	typ := u.next()
+	if typ != uaiBayes && typ != uaiMarkov {
+		return "", nil, nil, nil, fmt.Errorf("%v: unsupported uai type %q", fname, typ)
+	}
+	var vs vars.VarList
+	nv := u.int()
+	if u.err != nil {
+		return "", nil, nil, nil, u.err
+	}
+	for i := 0; i < nv && u.err == nil; i++ {
+		vs = append(vs, vars.New(i, u.int(), "", false))
+	}
+	nf := u.int()
+	if u.err != nil {
+		return "", nil, nil, nil, u.err
+	}
+	scopes := make([]vars.VarList, nf)
+	for i := 0; i < nf && u.err == nil; i++ {
+		n := u.int()
+		for j := 0; j < n && u.err == nil; j++ {
+			id := u.int()
+			if id >= len(vs) {
+				return "", nil, nil, nil, fmt.Errorf("%v: factor %v: invalid variable %v", fname, i, id)
+			}
+			if scopes[i].Contains(vs[id]) {
+				return "", nil, nil, nil, fmt.Errorf("%v: factor %v: repeated variable %v", fname, i, id)
+			}
+			scopes[i] = append(scopes[i], vs[id])
+		}
+	}
+	tables := make([][]float64, nf)
+	for i := 0; i < nf && u.err == nil; i++ {
+		n := u.int()
+		if want := nCells(scopes[i]); n != want {
+			return "", nil, nil, nil, fmt.Errorf("%v: factor %v: %v values, want %v", fname, i, n, want)
+		}
+		tables[i] = make([]float64, n)
+		for j := range tables[i] {
+			tables[i][j] = u.float()
+		}
+	}
+	if u.err != nil {
+		return "", nil, nil, nil, u.err
+	}
+	return typ, vs, scopes, tables, nil
+}
+
+// uaiFactor returns the factor of a uai table, whose last variable varies fastest
+func uaiFactor(scope vars.VarList, table []float64) *factor.Factor {
+	f := factor.New(scope...)
+	strides := make(map[int]int)
+	step := 1
+	for _, u := range f.Variables() {
+		strides[u.ID()] = step
+		step *= u.NState()
+	}
+	values := make([]float64, len(table))
+	for i := range table {
+		idx, k := 0, i
+		for j := len(scope) - 1; j >= 0; j-- {
+			idx += (k % scope[j].NState()) * strides[scope[j].ID()]
+			k /= scope[j].NState()
+		}
+		values[idx] = table[i]
+	}
+	return f.SetValues(values)
+}
+
+// readUAIModel reads a model from a uai file, a BAYES file gives a directed
+// model, where the last variable of each scope is the child and each table
+// sums to one over it, and a MARKOV file gives an undirected model with the
+// factors of the file
+func readUAIModel(fname string) (*Model, error) {
+	typ, vs, scopes, tables, err := readUAI(fname)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{Vars: vs}
+	for i, scope := range scopes {
+		if len(scope) == 0 {
+			return nil, fmt.Errorf("%v: factor %v: empty scope", fname, i)
+		}
+		f, x := uaiFactor(scope, tables[i]), scope[len(scope)-1]
+		m.Factors = append(m.Factors, f)
+		if typ == uaiBayes {
+			if !conditional(f, x) {
+				return nil, fmt.Errorf("%v: factor %v: table does not sum to one over variable %v", fname, i, x.ID())
+			}
+			m.Child = append(m.Child, x)
+		}
+	}
+	if typ == uaiBayes {
+		if _, err := m.BNet(); err != nil {
+			return nil, fmt.Errorf("%v: %v", fname, err)
+		}
+	}
+	return m, nil
+}
+
+// writeUAI writes a model in uai format, a BAYES file with the child as the last
+// variable of each scope or a MARKOV file, the last variable of each table varying fastest
+func writeUAI(m *Model, fname string, opt Options) error {
+	typ := uaiMarkov
+	switch opt.UAIType {
+	case "":
+		if m.Directed() {
+			typ = uaiBayes
+		}
+	case UAIBayes:
+		if err := m.orient(); err != nil {
+			return fmt.Errorf("%v: %v", fname, err)
+		}
+		typ = uaiBayes
+	case UAIMarkov:
+	default:
+		return fmt.Errorf("invalid uai type: (%v)", opt.UAIType)
+	}
+	scopes := make([]vars.VarList, len(m.Factors))
+	for i, fc := range m.Factors {
+		scopes[i] = fc.Variables()
+		if typ == uaiBayes {
+			scopes[i] = append(fc.Variables().Diff(vars.VarList{m.Child[i]}), m.Child[i])
+		}
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, typ)
+	fmt.Fprintf(w, "%v\n", len(m.Vars))
+	for _, v := range m.Vars {
+		fmt.Fprintf(w, "%v ", v.NState())
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%v\n", len(m.Factors))
+	for _, scope := range scopes {
+		fmt.Fprintf(w, "%v\t", len(scope))
+		for _, u := range scope {
+			fmt.Fprintf(w, "%v ", u.ID())
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+	for i, fc := range m.Factors {
+		values := smoothValues(fc.Values(), opt.Smooth)
+		fmt.Fprintf(w, "%v\n", len(values))
+		ixf := vars.NewOrderedIndex(fc.Variables(), scopes[i])
+		for !ixf.Ended() {
+			fmt.Fprintf(w, "%v ", values[ixf.I()])
+			ixf.NextRight()
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func nCells(vs vars.VarList) int {
+	n := 1
+	for _, v := range vs {
+		n *= v.NState()
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTemp(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	fname := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestReadUAI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name, content string
+		directed, bn  bool
+	}{
+		{"bayes.uai", "BAYES\n2\n2 2\n2\n1 0\n2 0 1\n\n2\n0.3 0.7\n4\n0.1 0.9 0.6 0.4\n", true, true},
+		{"markov.uai", "MARKOV\n2\n2 2\n2\n1 0\n2 0 1\n\n2\n0.3 0.7\n4\n0.1 0.9 0.6 0.4\n", false, true},
+		{"potts.uai", "MARKOV\n2\n2 2\n2\n1 0\n2 0 1\n\n2\n0.3 0.7\n4\n2 1 1 2\n", false, false},
+	}
+	for _, tt := range cases {
+		m, err := readUAIModel(writeTemp(t, dir, tt.name, tt.content))
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if m.Directed() != tt.directed {
+			t.Errorf("%v: directed %v, want %v", tt.name, m.Directed(), tt.directed)
+		}
+		// the last variable of the uai table varies fastest
+		if got, want := m.Factors[1].Values(), []float64{0.1, 0.6, 0.9, 0.4}; tt.bn && !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: values %v, want %v", tt.name, got, want)
+		}
+		bn, err := m.BNet()
+		if (err == nil) != tt.bn {
+			t.Errorf("%v: bnet error %v", tt.name, err)
+			continue
+		}
+		if tt.bn && !reflect.DeepEqual(bn.Node(m.Vars[1]).Parents().DumpAsInts(), []int{0}) {
+			t.Errorf("%v: parents of 1 %v, want [0]", tt.name, bn.Node(m.Vars[1]).Parents())
+		}
+	}
+	for _, content := range []string{
+		"FACTOR\n1\n2\n1\n1 0\n2\n0.5 0.5\n",
+		"BAYES\n1\n2\n1\n1 1\n2\n0.5 0.5\n",
+		"BAYES\n1\n2\n1\n1 0\n3\n0.5 0.5 0\n",
+		"BAYES\n2\n2 2\n2\n1 0\n1 0\n2\n0.5 0.5\n2\n0.5 0.5\n",
+		"MARKOV\n2\n2 2\n1\n2 0 1\n4\n0.1 0.9",
+		"MARKOV\n2\n2 2\n1\n2 0 0\n4\n1 1 1 1\n",
+		"BAYES\n2\n2 2\n2\n1 0\n2 0 1\n\n2\n0.3 0.7\n4\n0.1 0.9 0.6 0.6\n",
+		"BAYES\n2\n2 2\n2\n1 0\n2 0 1\n\n2\n0.3 0.8\n4\n0.1 0.9 0.6 0.4\n",
+	} {
+		if _, err := readUAIModel(writeTemp(t, dir, "bad.uai", content)); err == nil {
+			t.Errorf("want error reading %q", content)
+		}
+	}
+}
+
+func TestUAIRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	want, err := ReadModel(asiaBif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"", UAIBayes, UAIMarkov} {
+		uai, bif := filepath.Join(dir, "asia"+typ+".uai"), filepath.Join(dir, "asia"+typ+".bif")
+		if err := Convert(asiaBif, uai, "", "", "", Options{UAIType: typ}); err != nil {
+			t.Fatal(err)
+		}
+		preamble, _, scopes, _, err := readUAI(uai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantPre := map[string]string{"": uaiBayes, UAIBayes: uaiBayes, UAIMarkov: uaiMarkov}[typ]; preamble != wantPre {
+			t.Errorf("(%v): preamble %v, want %v", typ, preamble, wantPre)
+		}
+		if preamble == uaiBayes {
+			for i, scope := range scopes {
+				if child := scope[len(scope)-1]; child.ID() != want.Child[i].ID() {
+					t.Errorf("(%v): factor %v: last variable %v, want child %v", typ, i, child, want.Child[i])
+				}
+			}
+		}
+		m, err := ReadModel(uai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Directed() != (preamble == uaiBayes) {
+			t.Errorf("(%v): directed %v", typ, m.Directed())
+		}
+		equalModels(t, want, m, false)
+		if err := Convert(uai, bif, "", "", "", Options{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadModel(bif)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equalModels(t, want, got, false)
+	}
+}
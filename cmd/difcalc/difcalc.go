@@ -0,0 +1,276 @@
+package difcalc
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/britojr/exp-run/cmd"
+	"github.com/britojr/exp-run/cmd/infkey"
+	"github.com/britojr/exp-run/cmd/results"
+)
+
+// Cmd command struct
+var Cmd = &cmd.Command{}
+
+func init() {
+	Cmd.Name = "difcalc"
+	Cmd.Short = "compute distance between two inference results"
+	Cmd.Long = `
+Difcalc compares two inference result files of the same queries and writes
+the distance between them for each of the given metrics, parsing the files once.
+Each metric compares values of one kind: probabilities (mse, abs, max-abs,
+l1norm, l2norm), log-probabilities (log-abs), marginals (hellinger, kl,
+cross-entropy) or assignments (hamming, match).
+Log-probability files (infkey) are compared as probabilities, or as the
+bernoulli distributions (p, 1-p) of each query by the marginal metrics;
+MAR files are compared variable by variable and MPE/MAP files assignment by
+assignment, averaging over the lines. Zero probabilities of the second file
+are bounded away from zero by kl and cross-entropy.
+If a results file is given, a record of each distance is appended to it.
+
+With -per-item or -bootstrap the distance of each item (query, variable of
+a MAR file or assignment) is computed and a summary table is written with
+the median and quantiles of the items, and the bootstrap confidence interval
+of the distance when the number of resamples is given.
+
+With -ref the two input files are candidates compared to the reference file:
+the per-item distances of each candidate to the reference are compared by a
+paired wilcoxon signed-rank test and a paired t-test, reporting p-values and
+effect sizes (rank-biserial correlation and cohen's d of the differences);
+it cannot be combined with -results, -per-item or -bootstrap.`
+	Cmd.Examples = []string{
+		"difcalc -i1 asia.infkey -i2 asia-learned.infkey -dif mse",
+		"difcalc -i1 asia.infkey -i2 asia-learned.infkey -dif mse,kl,hellinger",
+		"difcalc -i1 asia.mpe -i2 asia-learned.mpe -dif hamming",
+		"difcalc -i1 asia.mar -i2 asia-learned.mar -dif kl,hellinger -per-item asia.items -bootstrap 1000",
+		"difcalc -ref asia.infkey -i1 asia-em.infkey -i2 asia-ml.infkey -dif mse,kl",
+		"difcalc -i1 asia.infkey -i2 asia-learned.infkey -dif kl -results res.jsonl -model asia -ntrain 500",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	inFile1 := Cmd.Flag.String("i1", "", "inference result 1")
+	inFile2 := Cmd.Flag.String("i2", "", "inference result 2")
+	outFile := Cmd.Flag.String("log", "", "output file")
+	distOpt := Cmd.Flag.String("dif", "", "comma separated distance functions ("+strings.Join(Metrics(), "|")+")")
+	resFile := Cmd.Flag.String("results", "", "results file to append a record to (.csv or .jsonl)")
+	refFile := Cmd.Flag.String("ref", "", "reference result, compares the per-item distances of i1 and i2 to it")
+	itemFile := Cmd.Flag.String("per-item", "", "file to write the distance of each item")
+	nBoot := Cmd.Flag.Int("bootstrap", 0, "number of bootstrap resamples of the confidence intervals")
+	ci := Cmd.Flag.Float64("ci", 0.95, "level of the bootstrap confidence intervals")
+	seed := Cmd.Flag.Int64("seed", 0, "random seed of the bootstrap (0 to use current time)")
+	var rec results.Record
+	Cmd.Flag.StringVar(&rec.Model, "model", "", "model name of the results record")
+	Cmd.Flag.StringVar(&rec.Learner, "learner", "", "learner name of the results record")
+	Cmd.Flag.IntVar(&rec.Train, "ntrain", 0, "training set size of the results record")
+	Cmd.Flag.IntVar(&rec.Test, "ntest", 0, "testing set size of the results record")
+	Cmd.Flag.IntVar(&rec.Cut, "ncut", 0, "number of hidden variables of the results record")
+	Cmd.Required = []string{"i1", "i2", "dif"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if len(*refFile) != 0 {
+			if len(*resFile) != 0 || len(*itemFile) != 0 || *nBoot > 0 {
+				return cmd.Usagef("-results, -per-item and -bootstrap cannot be used with -ref")
+			}
+			_, err := Compare(*refFile, *inFile1, *inFile2, *outFile, *distOpt)
+			return err
+		}
+		if len(*itemFile) == 0 && *nBoot <= 0 {
+			_, err := CalcDist(*inFile1, *inFile2, *outFile, *distOpt, *resFile, rec)
+			return err
+		}
+		sums, err := Breakdown(*inFile1, *inFile2, *outFile, *distOpt, *itemFile, *nBoot, *ci, *seed)
+		if err != nil || len(*resFile) == 0 {
+			return err
+		}
+		ms, res := make([]string, len(sums)), make([]float64, len(sums))
+		for i, s := range sums {
+			ms[i], res[i] = s.Metric, s.Value
+		}
+		return appendRecords(*resFile, rec, ms, res)
+	}
+}
+
+// CalcDist calculates the distances between values of two files for a comma separated
+// list of metrics, if resFile is given a record of each result is appended to it
+func CalcDist(inFile1, inFile2, outFile, distOpt, resFile string, rec results.Record) ([]float64, error) {
+	ps, err := readPairs(inFile1, inFile2, distOpt)
+	if err != nil {
+		return nil, err
+	}
+	ms, res := make([]string, len(ps)), make([]float64, len(ps))
+	for i, p := range ps {
+		ms[i], res[i] = p.m.Name, p.Eval(nil)
+	}
+	if err := writeDists(outFile, ms, res); err != nil {
+		return res, err
+	}
+	if len(resFile) != 0 {
+		return res, appendRecords(resFile, rec, ms, res)
+	}
+	return res, nil
+}
+
+// readPairs parses both files once and matches their items for each metric
+func readPairs(inFile1, inFile2, distOpt string) ([]*Pairs, error) {
+	ms, err := ParseMetrics(distOpt)
+	if err != nil {
+		return nil, err
+	}
+	v1, err := parseValues(inFile1)
+	if err != nil {
+		return nil, err
+	}
+	v2, err := parseValues(inFile2)
+	if err != nil {
+		return nil, err
+	}
+	// queries are matched by line, so infkey files must have the same number of lines
+	if v1.Kind == LogProb && v2.Kind == LogProb && len(v1.Rows[0]) != len(v2.Rows[0]) {
+		return nil, fmt.Errorf("line count mismatch: %v has %v values and %v has %v", inFile1, len(v1.Rows[0]), inFile2, len(v2.Rows[0]))
+	}
+	ps := make([]*Pairs, len(ms))
+	for i, m := range ms {
+		if ps[i], err = m.Pairs(v1, v2); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// appendRecords completes the record with each metric result and appends it to resFile
+func appendRecords(resFile string, rec results.Record, ms []string, res []float64) error {
+	for i, m := range ms {
+		rec.Metric, rec.Value = m, results.Value(res[i])
+		rec.Time, rec.Version = time.Now(), results.ToolVersion()
+		if err := results.Append(resFile, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDists writes the distance alone for a single metric,
+// or one line with the name and distance of each metric
+func writeDists(fname string, ms []string, res []float64) error {
+	var w io.Writer = os.Stdout
+	if len(fname) != 0 {
+		f, err := os.Create(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if len(ms) == 1 {
+		_, err := fmt.Fprintf(w, "%v\n", res[0])
+		return err
+	}
+	for i, m := range ms {
+		if _, err := fmt.Fprintf(w, "%v\t%v\n", m, res[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseValues(fname string) (v Values, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return v, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	line := scanner.Text()
+	f.Close()
+	switch line {
+	case "MAR":
+		v.Kind = Marginal
+		if v.Rows, err = readMarFile(fname); err != nil {
+			return v, err
+		}
+		log.Printf("%v: read %v variables\n", fname, len(v.Rows))
+	case "MPE", "MAP":
+		v.Kind = Assignment
+		if v.Rows, err = readMPEFile(fname); err != nil {
+			return v, err
+		}
+		log.Printf("%v: read %v assignments\n", fname, len(v.Rows))
+	default:
+		v.Kind = LogProb
+		fvals, err := infkey.Read(fname)
+		if err != nil {
+			return v, err
+		}
+		log.Printf("%v: read %v values\n", fname, len(fvals))
+		if n := infkey.CountNaN(fvals); n > 0 {
+			log.Printf("warning: %v: %v NaN values\n", fname, n)
+		}
+		v.Rows = append(v.Rows, fvals)
+	}
+	return v, nil
+}
+
+// readMarFile reads the marginals of all lines of a MAR file as a single list of variables
+func readMarFile(fname string) (ma [][]float64, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	mar := ""
+	fmt.Fscanln(r, &mar)
+	var n, card int
+	for {
+		if _, err := fmt.Fscan(r, &n); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: %v", fname, err)
+		}
+		for i := 0; i < n; i++ {
+			if _, err := fmt.Fscan(r, &card); err != nil {
+				return nil, fmt.Errorf("%v: %v", fname, err)
+			}
+			dist := make([]float64, card)
+			for j := range dist {
+				if _, err := fmt.Fscan(r, &dist[j]); err != nil {
+					return nil, fmt.Errorf("%v: %v", fname, err)
+				}
+			}
+			ma = append(ma, dist)
+		}
+	}
+	return ma, nil
+}
+
+// readMPEFile reads the assignments of an MPE/MAP file, unassigned variables are read as -1
+func readMPEFile(fname string) (xs [][]float64, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		states := strings.Split(fields[1], ",")
+		x := make([]float64, len(states))
+		for i, s := range states {
+			if v, err := strconv.Atoi(s); err == nil {
+				x[i] = float64(v)
+			} else {
+				x[i] = -1
+			}
+		}
+		xs = append(xs, x)
+	}
+	return xs, scanner.Err()
+}
@@ -0,0 +1,287 @@
+package difcalc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gonum/floats"
+)
+
+// Kind is the kind of values read from a result file or expected by a metric
+type Kind int
+
+// kinds of values
+const (
+	// Prob are probabilities compared element by element
+	Prob Kind = iota
+	// LogProb are log-probabilities as written by infer PR, -inf for impossible queries
+	LogProb
+	// Marginal are distributions that sum to one
+	Marginal
+	// Assignment are the states of MPE/MAP solutions, -1 for unassigned variables
+	Assignment
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Prob:
+		return "prob"
+	case LogProb:
+		return "logprob"
+	case Marginal:
+		return "marginal"
+	case Assignment:
+		return "assignment"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// minProb is the lower bound of the second distribution in kl and cross-entropy,
+// so they stay finite when a model gives zero probability to an event of the reference
+const minProb = 1e-12
+
+// Metric is a distance between two rows of values of the kind it declares
+type Metric struct {
+	Name  string
+	Input Kind
+	Dist  func(a, b []float64) float64
+}
+
+var metrics = map[string]Metric{
+	"mse":     {"mse", Prob, mse},
+	"abs":     {"abs", Prob, meanAbs},
+	"max-abs": {"max-abs", Prob, maxAbs},
+	"l1norm":  {"l1norm", Prob, func(a, b []float64) float64 { return floats.Distance(a, b, 1) }},
+	"l2norm":  {"l2norm", Prob, func(a, b []float64) float64 { return floats.Distance(a, b, 2) }},
+	"log-abs": {"log-abs", LogProb, logAbs},
+
+	"hellinger":     {"hellinger", Marginal, hellinger},
+	"kl":            {"kl", Marginal, kullbackLeibler},
+	"cross-entropy": {"cross-entropy", Marginal, crossEntropy},
+
+	"hamming": {"hamming", Assignment, hamming},
+	"match":   {"match", Assignment, func(a, b []float64) float64 { return 1 - math.Min(hamming(a, b), 1) }},
+}
+
+// Metrics returns the sorted names of the available metrics
+func Metrics() (names []string) {
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// ParseMetrics returns the metrics of a comma separated list of names
+func ParseMetrics(list string) ([]Metric, error) {
+	var ms []Metric
+	for _, name := range strings.Split(list, ",") {
+		m, ok := metrics[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid distance option: (%v)", name)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Values are the rows of values of a result file
+type Values struct {
+	Kind Kind
+	Rows [][]float64
+}
+
+// As converts the values to the given kind:
+// log-probabilities are exponentiated to be compared as probabilities,
+// or taken as the bernoulli distributions (p, 1-p) of each query to be compared as marginals,
+// marginals can be compared as probabilities or as log-probabilities,
+// and assignments can only be compared as assignments
+func (v Values) As(k Kind) ([][]float64, error) {
+	if v.Kind == k {
+		return v.Rows, nil
+	}
+	switch {
+	case v.Kind == LogProb && k == Prob:
+		return mapRows(v.Rows, math.Exp), nil
+	case v.Kind == LogProb && k == Marginal:
+		var rows [][]float64
+		for _, row := range v.Rows {
+			for _, lp := range row {
+				p := math.Min(math.Exp(lp), 1)
+				rows = append(rows, []float64{p, 1 - p})
+			}
+		}
+		return rows, nil
+	case v.Kind == Marginal && k == Prob:
+		return v.Rows, nil
+	case v.Kind == Marginal && k == LogProb:
+		return mapRows(v.Rows, math.Log), nil
+	}
+	return nil, fmt.Errorf("cannot compare %v values as %v", v.Kind, k)
+}
+
+// Pairs are the items compared by a metric, each item a pair of rows of the two files;
+// when the files are vectors of query log-probabilities each query is an item and the
+// metric is evaluated on the vectors of the selected queries
+type Pairs struct {
+	m      Metric
+	a, b   [][]float64
+	vector bool
+}
+
+// Pairs converts the values to the input kind of the metric and matches their items
+func (m Metric) Pairs(v1, v2 Values) (*Pairs, error) {
+	r1, err := v1.As(m.Input)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", m.Name, err)
+	}
+	r2, err := v2.As(m.Input)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", m.Name, err)
+	}
+	if len(r2) < len(r1) || len(r1) < 1 {
+		return nil, fmt.Errorf("size not enough to compare i1=%v i2=%v", len(r1), len(r2))
+	}
+	p := &Pairs{m: m, vector: v1.Kind == LogProb && (m.Input == Prob || m.Input == LogProb)}
+	for i, a := range r1 {
+		b := r2[i]
+		if len(b) < len(a) {
+			return nil, fmt.Errorf("size not enough to compare line %v: i1=%v i2=%v", i+1, len(a), len(b))
+		}
+		if p.vector {
+			for j := range a {
+				p.a, p.b = append(p.a, a[j:j+1]), append(p.b, b[j:j+1])
+			}
+		} else {
+			p.a, p.b = append(p.a, a), append(p.b, b[:len(a)])
+		}
+	}
+	return p, nil
+}
+
+// Len returns the number of items
+func (p *Pairs) Len() int {
+	return len(p.a)
+}
+
+// Items returns the distance of each item
+func (p *Pairs) Items() []float64 {
+	ds := make([]float64, len(p.a))
+	for i := range p.a {
+		ds[i] = p.m.Dist(p.a[i], p.b[i])
+	}
+	return ds
+}
+
+// Eval returns the distance of the items with the given indexes (all items if nil),
+// the distance of the vectors of selected queries or the average distance of the rows
+func (p *Pairs) Eval(idx []int) float64 {
+	if idx == nil {
+		idx = make([]int, len(p.a))
+		for i := range idx {
+			idx[i] = i
+		}
+	}
+	if p.vector {
+		a, b := make([]float64, len(idx)), make([]float64, len(idx))
+		for i, j := range idx {
+			a[i], b[i] = p.a[j][0], p.b[j][0]
+		}
+		return p.m.Dist(a, b)
+	}
+	sum := 0.0
+	for _, j := range idx {
+		sum += p.m.Dist(p.a[j], p.b[j])
+	}
+	return sum / float64(len(idx))
+}
+
+// Eval returns the distance between the values, averaged over the rows
+func (m Metric) Eval(v1, v2 Values) (float64, error) {
+	p, err := m.Pairs(v1, v2)
+	if err != nil {
+		return 0, err
+	}
+	return p.Eval(nil), nil
+}
+
+func mapRows(rows [][]float64, f func(float64) float64) [][]float64 {
+	res := make([][]float64, len(rows))
+	for i, row := range rows {
+		res[i] = make([]float64, len(row))
+		for j, x := range row {
+			res[i][j] = f(x)
+		}
+	}
+	return res
+}
+
+func mse(a, b []float64) (d float64) {
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d / float64(len(a))
+}
+
+func meanAbs(a, b []float64) (d float64) {
+	for i := range a {
+		d += math.Abs(a[i] - b[i])
+	}
+	return d / float64(len(a))
+}
+
+func maxAbs(a, b []float64) (d float64) {
+	for i := range a {
+		d = math.Max(d, math.Abs(a[i]-b[i]))
+	}
+	return
+}
+
+// logAbs is the mean absolute difference of log-probabilities,
+// two impossible queries have no difference
+func logAbs(a, b []float64) (d float64) {
+	for i := range a {
+		if a[i] != b[i] {
+			d += math.Abs(a[i] - b[i])
+		}
+	}
+	return d / float64(len(a))
+}
+
+func hellinger(a, b []float64) (d float64) {
+	for i := range a {
+		x := math.Sqrt(a[i]) - math.Sqrt(b[i])
+		d += x * x
+	}
+	return math.Sqrt(d / 2)
+}
+
+func kullbackLeibler(a, b []float64) (d float64) {
+	for i := range a {
+		if a[i] > 0 {
+			d += a[i] * (math.Log(a[i]) - math.Log(math.Max(b[i], minProb)))
+		}
+	}
+	return
+}
+
+func crossEntropy(a, b []float64) (d float64) {
+	for i := range a {
+		if a[i] > 0 {
+			d -= a[i] * math.Log(math.Max(b[i], minProb))
+		}
+	}
+	return
+}
+
+// hamming counts the positions where the two assignments differ
+func hamming(a, b []float64) (d float64) {
+	for i := range a {
+		if a[i] != b[i] {
+			d++
+		}
+	}
+	return
+}
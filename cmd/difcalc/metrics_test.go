@@ -0,0 +1,86 @@
+package difcalc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	inf := math.Inf(-1)
+	cases := []struct {
+		metric string
+		v1, v2 Values
+		want   float64
+	}{
+		{"mse", Values{LogProb, [][]float64{{0, math.Log(0.5)}}}, Values{LogProb, [][]float64{{math.Log(0.5), math.Log(0.5)}}}, 0.125},
+		{"abs", Values{LogProb, [][]float64{{inf, 0}}}, Values{LogProb, [][]float64{{math.Log(0.25), 0}}}, 0.125},
+		{"log-abs", Values{LogProb, [][]float64{{inf, -1}}}, Values{LogProb, [][]float64{{inf, -3}}}, 1},
+		{"kl", Values{LogProb, [][]float64{{inf, 0}}}, Values{LogProb, [][]float64{{0, 0}}}, -math.Log(minProb) / 2},
+		{"kl", Values{Marginal, [][]float64{{0.5, 0.5}}}, Values{Marginal, [][]float64{{0.5, 0.5}}}, 0},
+		{"kl", Values{Marginal, [][]float64{{1, 0}}}, Values{Marginal, [][]float64{{0, 1}}}, -math.Log(minProb)},
+		{"cross-entropy", Values{Marginal, [][]float64{{0, 1}}}, Values{Marginal, [][]float64{{0.5, 0.5}}}, math.Log(2)},
+		{"hellinger", Values{Marginal, [][]float64{{1, 0}, {0.5, 0.5}}}, Values{Marginal, [][]float64{{0, 1}, {0.5, 0.5}}}, 0.5},
+		{"hamming", Values{Assignment, [][]float64{{0, 1, -1}}}, Values{Assignment, [][]float64{{0, 0, 1}}}, 2},
+		{"match", Values{Assignment, [][]float64{{0, 1}, {1, 1}}}, Values{Assignment, [][]float64{{0, 1}, {1, 0}}}, 0.5},
+	}
+	for _, tt := range cases {
+		ms, err := ParseMetrics(tt.metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ms[0].Eval(tt.v1, tt.v2)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.metric, err)
+			continue
+		}
+		if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v: want %v, got %v", tt.metric, tt.want, got)
+		}
+	}
+}
+
+func TestEvalKinds(t *testing.T) {
+	probs := Values{LogProb, [][]float64{{0}}}
+	assigns := Values{Assignment, [][]float64{{0}}}
+	for _, name := range []string{"mse", "kl", "log-abs"} {
+		ms, _ := ParseMetrics(name)
+		if _, err := ms[0].Eval(assigns, assigns); err == nil {
+			t.Errorf("%v: comparing assignments should fail", name)
+		}
+	}
+	ms, _ := ParseMetrics("hamming")
+	if _, err := ms[0].Eval(probs, probs); err == nil {
+		t.Errorf("hamming: comparing log-probabilities should fail")
+	}
+	if _, err := ParseMetrics("mse,unknown"); err == nil {
+		t.Errorf("unknown metric should fail")
+	}
+}
+
+func TestPairs(t *testing.T) {
+	v1 := Values{LogProb, [][]float64{{0, math.Log(0.5), math.Log(0.25)}}}
+	v2 := Values{LogProb, [][]float64{{math.Log(0.5), math.Log(0.5), math.Log(0.75), 0}}}
+	ms, _ := ParseMetrics("mse,max-abs")
+	for _, m := range ms {
+		p, err := m.Pairs(v1, v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Len() != 3 {
+			t.Errorf("%v: want 3 items, got %v", m.Name, p.Len())
+		}
+		items := p.Items()
+		want := []float64{0.25, 0, 0.25}
+		if m.Name == "max-abs" {
+			want = []float64{0.5, 0, 0.5}
+		}
+		for i := range want {
+			if math.Abs(items[i]-want[i]) > 1e-9 {
+				t.Errorf("%v: item %v want %v, got %v", m.Name, i, want[i], items[i])
+			}
+		}
+		if got := p.Eval([]int{1, 1}); got != 0 {
+			t.Errorf("%v: resample of equal items want 0, got %v", m.Name, got)
+		}
+	}
+}
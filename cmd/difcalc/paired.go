@@ -0,0 +1,192 @@
+package difcalc
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// maxExactRanks is the largest number of differences for which the
+// wilcoxon p-value is computed from the exact distribution (when there are no ties)
+const maxExactRanks = 25
+
+// PairedTest compares the per-item distances of two candidates to the same reference
+type PairedTest struct {
+	Metric string
+	// N is the number of items with finite differences
+	N int
+	// Mean1 and Mean2 are the mean per-item distances of each candidate
+	Mean1, Mean2 float64
+	// W is the wilcoxon signed-rank statistic (sum of the ranks of positive differences),
+	// WP its two-sided p-value and RankBiserial the matched-pairs rank-biserial correlation
+	W, WP, RankBiserial float64
+	// T is the paired t statistic, TP its two-sided p-value and CohenD the mean
+	// difference over the standard deviation of the differences
+	T, TP, CohenD float64
+}
+
+// Compare computes the per-item distances of two candidate files to a reference file
+// for each metric and runs paired wilcoxon signed-rank and t tests on them
+func Compare(refFile, inFile1, inFile2, outFile, distOpt string) ([]PairedTest, error) {
+	ps1, err := readPairs(refFile, inFile1, distOpt)
+	if err != nil {
+		return nil, err
+	}
+	ps2, err := readPairs(refFile, inFile2, distOpt)
+	if err != nil {
+		return nil, err
+	}
+	tests := make([]PairedTest, len(ps1))
+	for i := range ps1 {
+		e1, e2 := ps1[i].Items(), ps2[i].Items()
+		if len(e1) != len(e2) {
+			return nil, fmt.Errorf("%v: candidates have %v and %v items", ps1[i].m.Name, len(e1), len(e2))
+		}
+		tests[i] = pairedTest(ps1[i].m.Name, e1, e2)
+	}
+	return tests, writeTests(outFile, tests)
+}
+
+func pairedTest(name string, e1, e2 []float64) PairedTest {
+	var x1, x2, d []float64
+	for i := range e1 {
+		if diff := e1[i] - e2[i]; !math.IsNaN(diff) && !math.IsInf(diff, 0) {
+			x1, x2, d = append(x1, e1[i]), append(x2, e2[i]), append(d, diff)
+		}
+	}
+	if skip := len(e1) - len(d); skip > 0 {
+		log.Printf("%v: skipped %v items with non finite differences\n", name, skip)
+	}
+	pt := PairedTest{Metric: name, N: len(d)}
+	pt.Mean1, pt.Mean2 = stat.Mean(x1, nil), stat.Mean(x2, nil)
+	pt.W, pt.WP, pt.RankBiserial = wilcoxon(d)
+	pt.T, pt.TP, pt.CohenD = pairedT(d)
+	return pt
+}
+
+// wilcoxon runs the signed-rank test on the differences, zero differences are dropped
+// and tied absolute differences get their average rank; the p-value is exact for
+// small samples without ties and uses the normal approximation otherwise
+func wilcoxon(d []float64) (w, p, r float64) {
+	var abs []float64
+	for _, x := range d {
+		if x != 0 {
+			abs = append(abs, math.Abs(x))
+		}
+	}
+	n := len(abs)
+	if n == 0 {
+		return 0, 1, 0
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return abs[idx[i]] < abs[idx[j]] })
+	ranks := make([]float64, n)
+	ties := false
+	tieSum := 0.0
+	for i := 0; i < n; {
+		j := i
+		for j < n && abs[idx[j]] == abs[idx[i]] {
+			j++
+		}
+		for k := i; k < j; k++ {
+			ranks[idx[k]] = float64(i+j+1) / 2
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieSum += t*t*t - t
+		}
+		i = j
+	}
+	k := 0
+	for _, x := range d {
+		if x > 0 {
+			w += ranks[k]
+		}
+		if x != 0 {
+			k++
+		}
+	}
+	total := float64(n*(n+1)) / 2
+	r = (2*w - total) / total
+	if n <= maxExactRanks && !ties {
+		return w, exactSignedRankP(n, w), r
+	}
+	mean := total / 2
+	sd := math.Sqrt(float64(n*(n+1)*(2*n+1))/24 - tieSum/48)
+	if sd == 0 {
+		return w, 1, r
+	}
+	// continuity correction towards the mean
+	z := (math.Abs(w-mean) - 0.5) / sd
+	if z < 0 {
+		z = 0
+	}
+	// erfc keeps the precision of the upper tail that 1-cdf loses
+	return w, math.Min(1, math.Erfc(z/math.Sqrt2)), r
+}
+
+// exactSignedRankP returns the two-sided p-value of the signed-rank statistic w
+// of n untied ranks, counting the subsets of ranks by their sum
+func exactSignedRankP(n int, w float64) float64 {
+	total := n * (n + 1) / 2
+	counts := make([]float64, total+1)
+	counts[0] = 1
+	for rank := 1; rank <= n; rank++ {
+		for s := total; s >= rank; s-- {
+			counts[s] += counts[s-rank]
+		}
+	}
+	lo := math.Min(w, float64(total)-w)
+	tail := 0.0
+	for s := 0; float64(s) <= lo; s++ {
+		tail += counts[s]
+	}
+	return math.Min(1, 2*tail/math.Pow(2, float64(n)))
+}
+
+// pairedT runs the t test of zero mean on the differences
+func pairedT(d []float64) (t, p, dz float64) {
+	n := len(d)
+	if n < 2 {
+		return 0, 1, 0
+	}
+	mean, sd := stat.MeanStdDev(d, nil)
+	if sd == 0 {
+		if mean == 0 {
+			return 0, 1, 0
+		}
+		return math.Copysign(math.Inf(1), mean), 0, math.Copysign(math.Inf(1), mean)
+	}
+	t = mean / (sd / math.Sqrt(float64(n)))
+	dist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(n - 1)}
+	return t, 2 * dist.Survival(math.Abs(t)), mean / sd
+}
+
+func writeTests(fname string, tests []PairedTest) error {
+	var w io.Writer = os.Stdout
+	if len(fname) != 0 {
+		f, err := os.Create(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "metric\tn\tmean1\tmean2\twilcoxon-w\twilcoxon-p\trank-biserial\tt\tt-p\tcohen-d")
+	for _, pt := range tests {
+		fmt.Fprintf(tw, "%v\t%v\t%.6g\t%.6g\t%.6g\t%.4g\t%.4g\t%.4g\t%.4g\t%.4g\n",
+			pt.Metric, pt.N, pt.Mean1, pt.Mean2, pt.W, pt.WP, pt.RankBiserial, pt.T, pt.TP, pt.CohenD)
+	}
+	return tw.Flush()
+}
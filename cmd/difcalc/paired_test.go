@@ -0,0 +1,37 @@
+package difcalc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPairedTest(t *testing.T) {
+	e2 := []float64{1, 1, 1, 1, 1}
+	e1 := []float64{1.5, 2.1, 0.7, 3.0, 1.7}
+	pt := pairedTest("mse", e1, e2)
+	if pt.N != 5 {
+		t.Errorf("want 5 items, got %v", pt.N)
+	}
+	// ranks of |d| = (0.5, 1.1, 0.3, 2.0, 0.7) are (2, 4, 1, 5, 3), only 0.3 is negative
+	if pt.W != 14 || math.Abs(pt.WP-0.125) > 1e-12 || math.Abs(pt.RankBiserial-13.0/15) > 1e-12 {
+		t.Errorf("wrong wilcoxon test, got w=%v p=%v r=%v", pt.W, pt.WP, pt.RankBiserial)
+	}
+	if math.Abs(pt.T-2.12298) > 1e-4 || math.Abs(pt.TP-0.1010) > 1e-3 || math.Abs(pt.CohenD-0.94942) > 1e-4 {
+		t.Errorf("wrong t test, got t=%v p=%v d=%v", pt.T, pt.TP, pt.CohenD)
+	}
+}
+
+func TestWilcoxonTies(t *testing.T) {
+	d := make([]float64, 40)
+	for i := range d {
+		d[i] = float64(i%4) - 1
+	}
+	// differences -1, 0, 1, 2: symmetric ties around zero except for the 2s
+	w, p, _ := wilcoxon(d)
+	if w <= 0 || p <= 0 || p >= 1 {
+		t.Errorf("wrong approximate test, got w=%v p=%v", w, p)
+	}
+	if _, p, r := wilcoxon(make([]float64, 10)); p != 1 || r != 0 {
+		t.Errorf("zero differences should not be significant, got p=%v r=%v", p, r)
+	}
+}
@@ -0,0 +1,148 @@
+package difcalc
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Summary describes the distribution of the per-item distances of a metric
+type Summary struct {
+	Metric string
+	// Value is the distance of all items, as computed by CalcDist
+	Value float64
+	// quantiles of the per-item distances
+	Median, Q05, Q25, Q75, Q95 float64
+	// Lo and Hi bound the bootstrap confidence interval of Value, NaN if not computed
+	Lo, Hi float64
+}
+
+// Breakdown computes the per-item distances of a comma separated list of metrics,
+// writing them to itemFile if given, and writes a summary with their quantiles and,
+// if nBoot > 0, the bootstrap confidence intervals of the distances at level ci
+func Breakdown(inFile1, inFile2, outFile, distOpt, itemFile string, nBoot int, ci float64, seed int64) ([]Summary, error) {
+	if ci <= 0 || ci >= 1 {
+		return nil, fmt.Errorf("invalid confidence level: %v", ci)
+	}
+	ps, err := readPairs(inFile1, inFile2, distOpt)
+	if err != nil {
+		return nil, err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if nBoot > 0 {
+		log.Printf("bootstrap with %v resamples and seed %v\n", nBoot, seed)
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	items := make([][]float64, len(ps))
+	sums := make([]Summary, len(ps))
+	for i, p := range ps {
+		items[i] = p.Items()
+		if sums[i], err = summarize(p, items[i], nBoot, ci, rnd); err != nil {
+			return nil, err
+		}
+	}
+	if len(itemFile) != 0 {
+		if err := writeItems(itemFile, ps, items); err != nil {
+			return sums, err
+		}
+	}
+	return sums, writeSummaries(outFile, sums, nBoot > 0)
+}
+
+func summarize(p *Pairs, items []float64, nBoot int, ci float64, rnd *rand.Rand) (Summary, error) {
+	if len(items) == 0 || p.Len() == 0 {
+		return Summary{}, fmt.Errorf("%v: no items to summarize", p.m.Name)
+	}
+	s := Summary{Metric: p.m.Name, Value: p.Eval(nil), Lo: math.NaN(), Hi: math.NaN()}
+	sorted := append([]float64(nil), items...)
+	sort.Float64s(sorted)
+	s.Median = stat.Quantile(0.5, stat.Empirical, sorted, nil)
+	s.Q05 = stat.Quantile(0.05, stat.Empirical, sorted, nil)
+	s.Q25 = stat.Quantile(0.25, stat.Empirical, sorted, nil)
+	s.Q75 = stat.Quantile(0.75, stat.Empirical, sorted, nil)
+	s.Q95 = stat.Quantile(0.95, stat.Empirical, sorted, nil)
+	if nBoot > 0 {
+		s.Lo, s.Hi = bootstrap(p, nBoot, ci, rnd)
+	}
+	return s, nil
+}
+
+// bootstrap returns the percentile interval of the distance of items resampled with replacement,
+// p must have at least one item
+func bootstrap(p *Pairs, nBoot int, ci float64, rnd *rand.Rand) (lo, hi float64) {
+	vs := make([]float64, nBoot)
+	idx := make([]int, p.Len())
+	for r := range vs {
+		for i := range idx {
+			idx[i] = rnd.Intn(p.Len())
+		}
+		vs[r] = p.Eval(idx)
+	}
+	sort.Float64s(vs)
+	alpha := (1 - ci) / 2
+	return stat.Quantile(alpha, stat.Empirical, vs, nil), stat.Quantile(1-alpha, stat.Empirical, vs, nil)
+}
+
+// writeItems writes a line with the item number and its distance for each metric
+func writeItems(fname string, ps []*Pairs, items [][]float64) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	names, n := make([]string, len(ps)), 0
+	for i, p := range ps {
+		names[i] = p.m.Name
+		if len(items[i]) > n {
+			n = len(items[i])
+		}
+	}
+	fmt.Fprintf(w, "item\t%s\n", strings.Join(names, "\t"))
+	for j := 0; j < n; j++ {
+		line := make([]string, len(items))
+		for i := range items {
+			if j < len(items[i]) {
+				line[i] = fmt.Sprint(items[i][j])
+			}
+		}
+		fmt.Fprintf(w, "%v\t%s\n", j+1, strings.Join(line, "\t"))
+	}
+	return nil
+}
+
+func writeSummaries(fname string, sums []Summary, withCI bool) error {
+	var w io.Writer = os.Stdout
+	if len(fname) != 0 {
+		f, err := os.Create(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	hdr := "metric\tvalue\tmedian\tq05\tq25\tq75\tq95"
+	if withCI {
+		hdr += "\tci-low\tci-high"
+	}
+	fmt.Fprintln(tw, hdr)
+	for _, s := range sums {
+		fmt.Fprintf(tw, "%v\t%.6g\t%.6g\t%.6g\t%.6g\t%.6g\t%.6g", s.Metric, s.Value, s.Median, s.Q05, s.Q25, s.Q75, s.Q95)
+		if withCI {
+			fmt.Fprintf(tw, "\t%.6g\t%.6g", s.Lo, s.Hi)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
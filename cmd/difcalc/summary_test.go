@@ -0,0 +1,53 @@
+package difcalc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	// abs distance of each row is its value, the items are 1..9 and 10 shuffled
+	var a, b [][]float64
+	for _, x := range []float64{7, 3, 10, 1, 5, 9, 2, 8, 4, 6} {
+		a, b = append(a, []float64{x}), append(b, []float64{0})
+	}
+	p := &Pairs{m: metrics["abs"], a: a, b: b}
+	s, err := summarize(p, p.Items(), 500, 0.9, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// empirical quantiles of 1..10 take the smallest value with cdf >= q
+	want := []struct {
+		name      string
+		got, want float64
+	}{
+		{"value", s.Value, 5.5},
+		{"median", s.Median, 5},
+		{"q05", s.Q05, 1},
+		{"q25", s.Q25, 3},
+		{"q75", s.Q75, 8},
+		{"q95", s.Q95, 10},
+	}
+	for _, w := range want {
+		if math.Abs(w.got-w.want) > 1e-12 {
+			t.Errorf("%v: got %v, want %v", w.name, w.got, w.want)
+		}
+	}
+	if !(s.Lo <= s.Value && s.Value <= s.Hi) || s.Lo == s.Hi {
+		t.Errorf("confidence interval [%v, %v] does not contain %v", s.Lo, s.Hi, s.Value)
+	}
+	again, _ := summarize(p, p.Items(), 500, 0.9, rand.New(rand.NewSource(1)))
+	if again != s {
+		t.Errorf("same seed gives %+v and %+v", again, s)
+	}
+
+	s, err = summarize(p, p.Items(), 0, 0.9, nil)
+	if err != nil || !math.IsNaN(s.Lo) || !math.IsNaN(s.Hi) {
+		t.Errorf("want no interval without bootstrap, got [%v, %v] %v", s.Lo, s.Hi, err)
+	}
+	empty := &Pairs{m: metrics["abs"]}
+	if _, err := summarize(empty, nil, 100, 0.9, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("want error on empty items")
+	}
+}
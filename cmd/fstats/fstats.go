@@ -3,14 +3,14 @@ package fstats
 import (
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"os"
 	"path"
 	"strings"
 
 	"github.com/britojr/bnutils/bif"
 	"github.com/britojr/exp-run/cmd"
 	"github.com/britojr/utl/conv"
-	"github.com/britojr/utl/errchk"
 	"github.com/gonum/floats"
 )
 
@@ -19,66 +19,92 @@ var Cmd = &cmd.Command{}
 func init() {
 	Cmd.Name = "fstats"
 	Cmd.Short = "provide file information"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		src := cm.Flag.String("i", "", "input file")
-		cm.Flag.Parse(args)
-		if len(*src) == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
+	Cmd.Long = `
+Fstats prints the names, cardinalities and structure counts of a model file,
+along with its number of parameters and whether it has unnormalized or
+deterministic distributions. Only bif files are supported.`
+	Cmd.Examples = []string{
+		"fstats -i asia.bif",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	src := Cmd.Flag.String("i", "", "input file")
+	Cmd.Required = []string{"i"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		st, err := FileStats(*src)
+		if err != nil {
+			return err
 		}
-		FileStats(*src)
+		printStats(os.Stdout, st)
+		return nil
 	}
 }
 
-func FileStats(fname string) {
-	fmt.Printf("File name: %v\n", fname)
+// Stats are the names, cardinalities and structure counts of a model
+type Stats struct {
+	File                        string
+	Names                       []string
+	Schema                      []int
+	Variables                   int
+	Roots, Leafs, Internals     int
+	Parameters                  int
+	Unnormalized, Deterministic bool
+}
+
+// FileStats returns the stats of a model file
+func FileStats(fname string) (*Stats, error) {
 	switch path.Ext(fname) {
 	case ".bif":
-		bifStats(fname)
-	default:
-		fmt.Printf("format not supported\n")
-		return
+		return bifStats(fname)
 	}
+	return nil, fmt.Errorf("format not supported: (%v)", path.Ext(fname))
 }
 
-func bifStats(fname string) {
+func bifStats(fname string) (*Stats, error) {
 	b, err := bif.ParseStruct(fname)
-	errchk.Check(err, "")
-	params := 0
-	determ := false
-	unnorm := false
-	schema := make([]int, len(b.Variables()))
-	vnames := make([]string, len(b.Variables()))
+	if err != nil {
+		return nil, err
+	}
+	st := &Stats{
+		File:      fname,
+		Names:     make([]string, len(b.Variables())),
+		Schema:    make([]int, len(b.Variables())),
+		Variables: len(b.Variables()),
+		Roots:     len(b.Roots()),
+		Leafs:     len(b.Leafs()),
+		Internals: len(b.Internals()),
+	}
 	for i, v := range b.Variables() {
 		f := b.Factor(v.Name())
-		schema[i] = v.NState()
-		vnames[i] = v.Name()
-		params += len(f.Values())
+		st.Schema[i] = v.NState()
+		st.Names[i] = v.Name()
+		st.Parameters += len(f.Values())
 		for _, p := range f.Values() {
 			if p == 1.0 || p == 0.0 {
-				determ = true
+				st.Deterministic = true
 				break
 			}
 		}
 		g, err := f.Copy().Normalize(v)
 		if err != nil {
-			fmt.Printf("error: %v on factor %v\n", err, v.Name())
+			return nil, fmt.Errorf("%v: factor %v: %v", fname, v.Name(), err)
 		}
 		if !floats.EqualApprox(g.Values(), f.Values(), 1e-6) {
-			unnorm = true
+			st.Unnormalized = true
 		}
 	}
+	return st, nil
+}
 
-	vs, rs, ls, is := len(b.Variables()), len(b.Roots()), len(b.Leafs()), len(b.Internals())
-	fmt.Printf("Names: %v\n", strings.Join(vnames, ","))
-	fmt.Printf("Schema: %v\n", strings.Join(conv.Sitoa(schema), ","))
-	fmt.Printf("Variables: %v\n", vs)
-	fmt.Printf("Roots:\t%v\t(%.2f%%)\n", rs, 100.0*float64(rs)/float64(vs))
-	fmt.Printf("Leafs:\t%v\t(%.2f%%)\n", ls, 100.0*float64(ls)/float64(vs))
-	fmt.Printf("Internals:\t%v\t(%.2f%%)\n", is, 100.0*float64(is)/float64(vs))
-	fmt.Printf("Parameters: %v\n", params)
-	fmt.Printf("Unnormalized: %v\n", unnorm)
-	fmt.Printf("Deterministic values: %v\n", determ)
+func printStats(w io.Writer, st *Stats) {
+	vs := float64(st.Variables)
+	fmt.Fprintf(w, "File name: %v\n", st.File)
+	fmt.Fprintf(w, "Names: %v\n", strings.Join(st.Names, ","))
+	fmt.Fprintf(w, "Schema: %v\n", strings.Join(conv.Sitoa(st.Schema), ","))
+	fmt.Fprintf(w, "Variables: %v\n", st.Variables)
+	fmt.Fprintf(w, "Roots:\t%v\t(%.2f%%)\n", st.Roots, 100.0*float64(st.Roots)/vs)
+	fmt.Fprintf(w, "Leafs:\t%v\t(%.2f%%)\n", st.Leafs, 100.0*float64(st.Leafs)/vs)
+	fmt.Fprintf(w, "Internals:\t%v\t(%.2f%%)\n", st.Internals, 100.0*float64(st.Internals)/vs)
+	fmt.Fprintf(w, "Parameters: %v\n", st.Parameters)
+	fmt.Fprintf(w, "Unnormalized: %v\n", st.Unnormalized)
+	fmt.Fprintf(w, "Deterministic values: %v\n", st.Deterministic)
 }
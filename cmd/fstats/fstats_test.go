@@ -0,0 +1,30 @@
+package fstats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileStats(t *testing.T) {
+	st, err := FileStats("../examples/asia.bif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Stats{
+		File:          "../examples/asia.bif",
+		Names:         []string{"asia", "tub", "smoke", "lung", "bronc", "either", "xray", "dysp"},
+		Schema:        []int{2, 2, 2, 2, 2, 2, 2, 2},
+		Variables:     8,
+		Roots:         2,
+		Leafs:         2,
+		Internals:     4,
+		Parameters:    36,
+		Deterministic: true,
+	}
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("got %+v, want %+v", st, want)
+	}
+	if _, err := FileStats("asia.uai"); err == nil {
+		t.Errorf("want error on unsupported format")
+	}
+}
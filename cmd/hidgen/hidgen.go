@@ -1,73 +1,102 @@
 package hidgen
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/britojr/bnutils/bif"
 	"github.com/britojr/exp-run/cmd"
 	"github.com/britojr/utl/conv"
-	"github.com/britojr/utl/errchk"
-	"github.com/britojr/utl/ioutl"
 	"github.com/kniren/gota/dataframe"
 )
 
-var randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 var Cmd = &cmd.Command{}
 
 func init() {
 	Cmd.Name = "hidgen"
 	Cmd.Short = "generate a cut on internal variables"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		bifFile := cm.Flag.String("m", "", "model in bif format")
-		cutFile := cm.Flag.String("c", "", "cut file (list of variables to hide)")
-		inFile := cm.Flag.String("i", "", "input file to cut")
-		outFile := cm.Flag.String("o", "", "output resulting file")
-		num := cm.Flag.Int("n", 0, "number of variables to hide")
-		cm.Flag.Parse(args)
-		if len(*bifFile) != 0 && len(*cutFile) != 0 && *num != 0 {
-			generateCut(*bifFile, *cutFile, *num)
-			return
+	Cmd.Long = `
+Hidgen has two modes. With a model and a number of variables it writes a cut
+file listing that many internal variables chosen at random; with a cut file
+and an input dataset it writes the dataset without the columns of the cut.`
+	Cmd.Examples = []string{
+		"hidgen -m asia.bif -c asia.cut -n 2",
+		"hidgen -m asia.bif -c asia.cut -n 2 -seed 7",
+		"hidgen -c asia.cut -i asia.train -o asia-cut.train",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	bifFile := Cmd.Flag.String("m", "", "model in bif format")
+	cutFile := Cmd.Flag.String("c", "", "cut file (list of variables to hide)")
+	inFile := Cmd.Flag.String("i", "", "input file to cut")
+	outFile := Cmd.Flag.String("o", "", "output resulting file")
+	num := Cmd.Flag.Int("n", 0, "number of variables to hide")
+	seed := Cmd.Flag.Int64("seed", 0, "random seed (0 to use current time)")
+	Cmd.Required = []string{"c"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if len(*bifFile) != 0 && *num != 0 {
+			return GenerateCut(*bifFile, *cutFile, *num, *seed)
 		}
-		if len(*cutFile) != 0 && len(*inFile) != 0 && len(*outFile) != 0 {
-			applyCut(*cutFile, *inFile, *outFile)
-			return
+		if len(*inFile) != 0 && len(*outFile) != 0 {
+			return ApplyCut(*cutFile, *inFile, *outFile)
 		}
-		log.Printf("error: missing arguments!\n")
-		cm.Flag.PrintDefaults()
+		return cmd.Usagef("either -m and -n or -i and -o are needed")
 	}
 }
 
-func generateCut(bifFile, cutFile string, num int) {
+// GenerateCut writes a cut file with num internal variables sampled from the model,
+// the same seed giving the same cut (0 to use current time)
+func GenerateCut(bifFile, cutFile string, num int, seed int64) error {
 	b, err := bif.ParseStruct(bifFile)
-	errchk.Check(err, "")
-	f := ioutl.CreateFile(cutFile)
-	defer f.Close()
-	xs := sampleInternals(b, num)
+	if err != nil {
+		return err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	xs := sampleInternals(b, num, rand.New(rand.NewSource(seed)))
 	sort.Ints(xs)
-	log.Printf("create %v with %v variables\n", f.Name(), len(xs))
-	fmt.Fprintln(f, strings.Join(conv.Sitoa(xs), ","))
+	log.Printf("create %v with %v variables\n", cutFile, len(xs))
+	return ioutil.WriteFile(cutFile, []byte(strings.Join(conv.Sitoa(xs), ",")+"\n"), 0644)
 }
 
-func applyCut(cutFile, inFile, outFile string) {
-	cf := ioutl.OpenFile(cutFile)
-	defer cf.Close()
-	scanner := bufio.NewScanner(cf)
-	scanner.Scan()
-	xs := conv.Satoi(strings.Split(scanner.Text(), ","))
-	makeFileCut(inFile, outFile, xs)
+// ApplyCut writes the input file without the columns listed in the cut file
+func ApplyCut(cutFile, inFile, outFile string) error {
+	xs, err := ReadCut(cutFile)
+	if err != nil {
+		return err
+	}
+	return makeFileCut(inFile, outFile, xs)
 }
 
-func sampleInternals(b *bif.Struct, n int) (xs []int) {
+// ReadCut returns the ids of the variables listed in a cut file
+func ReadCut(cutFile string) (xs []int, err error) {
+	data, err := ioutil.ReadFile(cutFile)
+	if err != nil {
+		return nil, err
+	}
+	if line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0]); len(line) != 0 {
+		for _, c := range strings.Split(line, ",") {
+			x, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", cutFile, err)
+			}
+			xs = append(xs, x)
+		}
+	}
+	return xs, nil
+}
+
+func sampleInternals(b *bif.Struct, n int, rnd *rand.Rand) (xs []int) {
 	is := b.Internals()
-	perm := randSource.Perm(len(is))
+	perm := rnd.Perm(len(is))
 	if n > len(is) {
 		n = len(is)
 	}
@@ -77,9 +106,17 @@ func sampleInternals(b *bif.Struct, n int) (xs []int) {
 	return
 }
 
-func makeFileCut(fi, fo string, cols []int) {
+func makeFileCut(fi, fo string, cols []int) error {
 	log.Printf("creating %v\n", fo)
-	df := dataframe.ReadCSV(ioutl.OpenFile(fi), dataframe.HasHeader(false)).Drop(cols)
-	err := df.WriteCSV(ioutl.CreateFile(fo), dataframe.WriteHeader(false))
-	errchk.Check(err, "")
+	r, err := os.Open(fi)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(fo)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return dataframe.ReadCSV(r, dataframe.HasHeader(false)).Drop(cols).WriteCSV(w, dataframe.WriteHeader(false))
 }
@@ -0,0 +1,311 @@
+package inference
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/britojr/exp-run/cmd/convert"
+)
+
+// inference backends
+const (
+	Native  = "native"
+	UAI2010 = "uai2010"
+	LibDAI  = "libdai"
+)
+
+func Backends() []string {
+	return []string{Native, UAI2010, LibDAI}
+}
+
+// default solver commands of external backends
+const (
+	uaiSolver = "uai2010-aie-solver"
+	daiSolver = "dai-solver"
+)
+
+// rounding tolerance on log-probabilities
+const roundTol = 1e-9
+
+// InferenceBackend computes probabilities on a fixed model
+type InferenceBackend interface {
+	// LogPR returns the log-probability of each evidence row (map of var id to state)
+	LogPR(evs []map[int]int) ([]float64, error)
+}
+
+// MARBackend is implemented by backends that also compute posterior marginals
+type MARBackend interface {
+	InferenceBackend
+	// MAR returns, for each evidence row, the posterior marginal of every variable
+	MAR(evs []map[int]int) ([][][]float64, error)
+}
+
+// MAPBackend is implemented by backends that compute most probable explanations
+type MAPBackend interface {
+	InferenceBackend
+	// MAP returns, for each evidence row, the most probable assignment of mapVars
+	// (of all variables if nil) indexed by var id with -1 for variables not assigned,
+	// and the log-probability of the assignment together with the evidence
+	MAP(evs []map[int]int, mapVars []int) ([][]int, []float64, error)
+}
+
+// NewBackend creates the named backend for the given model file,
+// solver overrides the command used by external backends and
+// evidence rows are split among the given number of workers
+func NewBackend(name, mFile, solver string, workers int) (InferenceBackend, error) {
+	switch name {
+	case Native:
+		bn, err := convert.ReadBNet(mFile)
+		if err != nil {
+			return nil, err
+		}
+		return &nativeBackend{newVEEngine(bn), newJTEngine(bn), workers}, nil
+	case UAI2010:
+		mdName, err := backendModel(name, mFile, "uai")
+		if err != nil {
+			return nil, err
+		}
+		if len(solver) == 0 {
+			solver = uaiSolver
+		}
+		return &solverBackend{mdName, workers, func(mdName, evName, task string) string {
+			return fmt.Sprintf("%s %s %s %v %s", solver, mdName, evName, time.Now().UnixNano(), task)
+		}}, nil
+	case LibDAI:
+		mdName, err := backendModel(name, mFile, "fg")
+		if err != nil {
+			return nil, err
+		}
+		if len(solver) == 0 {
+			solver = daiSolver
+		}
+		return &solverBackend{mdName, workers, func(mdName, evName, task string) string {
+			return fmt.Sprintf("%s %s %s %s", solver, mdName, evName, task)
+		}}, nil
+	}
+	return nil, fmt.Errorf("invalid backend option: (%v)", name)
+}
+
+// backendModel returns the model file in the given format, mFile itself or its cached
+// conversion when convert has a conversion from the format of mFile
+func backendModel(name, mFile, format string) (string, error) {
+	in := strings.TrimPrefix(filepath.Ext(mFile), ".")
+	if in == format {
+		return mFile, nil
+	}
+	convType := in + "2" + format
+	for _, c := range convert.ConvTypes() {
+		if c == convType {
+			return convert.Cached(mFile, convType, convert.Options{})
+		}
+	}
+	return "", fmt.Errorf("backend %v: unsupported model format (%v)", name, filepath.Ext(mFile))
+}
+
+// nativeBackend runs exact inference in process, sharing the engines among goroutines
+type nativeBackend struct {
+	e       *veEngine
+	jt      *jtEngine
+	workers int
+}
+
+func (b *nativeBackend) LogPR(evs []map[int]int) ([]float64, error) {
+	probs := make([]float64, len(evs))
+	parallel(len(evs), b.workers, func(lo, hi int) error {
+		for i := lo; i < hi; i++ {
+			probs[i] = b.e.logPR(evs[i])
+		}
+		return nil
+	})
+	return probs, nil
+}
+
+func (b *nativeBackend) MAR(evs []map[int]int) ([][][]float64, error) {
+	mars := make([][][]float64, len(evs))
+	parallel(len(evs), b.workers, func(lo, hi int) error {
+		for i := lo; i < hi; i++ {
+			mars[i] = b.jt.marginals(evs[i])
+		}
+		return nil
+	})
+	return mars, nil
+}
+
+func (b *nativeBackend) MAP(evs []map[int]int, mapVars []int) ([][]int, []float64, error) {
+	xs := make([][]int, len(evs))
+	probs := make([]float64, len(evs))
+	parallel(len(evs), b.workers, func(lo, hi int) error {
+		for i := lo; i < hi; i++ {
+			xs[i], probs[i] = b.e.maxLogPR(evs[i], mapVars)
+		}
+		return nil
+	})
+	return xs, probs, nil
+}
+
+// solverBackend runs an external solver that reads the model and an evidence file
+// in uai format and writes the results to the model name followed by the task extension;
+// each worker runs a subprocess in its own directory
+type solverBackend struct {
+	mdName  string
+	workers int
+	cmdLine func(mdName, evName, task string) string
+}
+
+func (b *solverBackend) LogPR(evs []map[int]int) ([]float64, error) {
+	probs := make([]float64, len(evs))
+	err := parallel(len(evs), b.workers, func(lo, hi int) error {
+		return b.run(evs[lo:hi], PR, func(fname string) error {
+			ps, err := parsePR(fname)
+			if err != nil {
+				return err
+			}
+			if len(ps) != hi-lo {
+				return fmt.Errorf("solver returned %v values for %v evidence rows", len(ps), hi-lo)
+			}
+			copy(probs[lo:hi], ps)
+			return nil
+		})
+	})
+	return probs, err
+}
+
+func (b *solverBackend) MAR(evs []map[int]int) ([][][]float64, error) {
+	mars := make([][][]float64, len(evs))
+	err := parallel(len(evs), b.workers, func(lo, hi int) error {
+		return b.run(evs[lo:hi], MAR, func(fname string) error {
+			ms, err := parseMAR(fname)
+			if err != nil {
+				return err
+			}
+			if len(ms) != hi-lo {
+				return fmt.Errorf("solver returned %v marginals for %v evidence rows", len(ms), hi-lo)
+			}
+			copy(mars[lo:hi], ms)
+			return nil
+		})
+	})
+	return mars, err
+}
+
+// MAP runs the solver MPE task, the log-probabilities are then computed as the
+// probability of evidence of the full assignments; MAP over a subset is not supported
+func (b *solverBackend) MAP(evs []map[int]int, mapVars []int) ([][]int, []float64, error) {
+	if mapVars != nil {
+		return nil, nil, fmt.Errorf("external solvers do not support %v queries", MAP)
+	}
+	xs := make([][]int, len(evs))
+	err := parallel(len(evs), b.workers, func(lo, hi int) error {
+		return b.run(evs[lo:hi], MPE, func(fname string) error {
+			as, err := parseMPE(fname)
+			if err != nil {
+				return err
+			}
+			if len(as) != hi-lo {
+				return fmt.Errorf("solver returned %v assignments for %v evidence rows", len(as), hi-lo)
+			}
+			copy(xs[lo:hi], as)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	full := make([]map[int]int, len(xs))
+	for i, x := range xs {
+		full[i] = make(map[int]int)
+		for id, s := range x {
+			full[i][id] = s
+		}
+	}
+	probs, err := b.LogPR(full)
+	return xs, probs, err
+}
+
+// run calls the solver on a temporary directory with a link to the model
+// and passes the name of the solver output file to parse
+func (b *solverBackend) run(evs []map[int]int, task string, parse func(fname string) error) error {
+	dir, err := ioutil.TempDir("", "exp-run")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	src, err := filepath.Abs(b.mdName)
+	if err != nil {
+		return err
+	}
+	mdName := filepath.Join(dir, filepath.Base(b.mdName))
+	if err := os.Symlink(src, mdName); err != nil {
+		return err
+	}
+	evName := mdName + ".evid"
+	if err := writeEvid(evName, evs); err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", b.cmdLine(mdName, evName, task))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("solver failed: %v", err)
+	}
+	return parse(mdName + "." + task)
+}
+
+// parallel splits n rows in contiguous shards processed concurrently by up to k workers
+func parallel(n, k int, f func(lo, hi int) error) error {
+	if k < 1 {
+		k = 1
+	}
+	if k > n {
+		k = n
+	}
+	errs := make([]error, k)
+	var wg sync.WaitGroup
+	for w := 0; w < k; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = f(w*n/k, (w+1)*n/k)
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEvid writes evidence rows in uai evid format
+func writeEvid(fname string, evs []map[int]int) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	fmt.Fprintf(w, "%v\n", len(evs))
+	for _, evid := range evs {
+		fmt.Fprintf(w, "%v ", len(evid))
+		for _, id := range sortedKeys(evid) {
+			fmt.Fprintf(w, "%v %v ", id, evid[id])
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func sortedKeys(m map[int]int) []int {
+	ks := make([]int, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Ints(ks)
+	return ks
+}
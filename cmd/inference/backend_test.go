@@ -0,0 +1,179 @@
+package inference
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/britojr/exp-run/cmd/convert"
+)
+
+func TestParallel(t *testing.T) {
+	cases := []struct{ n, k int }{{10, 3}, {10, 4}, {7, 1}, {7, 0}, {2, 5}, {1, 4}, {0, 3}}
+	for _, tt := range cases {
+		var mu sync.Mutex
+		seen := make([]int, tt.n)
+		shards := 0
+		err := parallel(tt.n, tt.k, func(lo, hi int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if lo >= hi {
+				t.Errorf("n=%v k=%v: empty shard [%v,%v)", tt.n, tt.k, lo, hi)
+			}
+			for i := lo; i < hi; i++ {
+				seen[i]++
+			}
+			shards++
+			return nil
+		})
+		if err != nil {
+			t.Errorf("n=%v k=%v: %v", tt.n, tt.k, err)
+		}
+		for i, c := range seen {
+			if c != 1 {
+				t.Errorf("n=%v k=%v: row %v processed %v times", tt.n, tt.k, i, c)
+			}
+		}
+		// at most k shards, at least one, and no more than rows
+		limit := tt.k
+		if limit < 1 {
+			limit = 1
+		}
+		if limit > tt.n {
+			limit = tt.n
+		}
+		if shards > limit {
+			t.Errorf("n=%v k=%v: %v shards, want at most %v", tt.n, tt.k, shards, limit)
+		}
+	}
+	fail := errors.New("fail")
+	err := parallel(9, 4, func(lo, hi int) error {
+		if lo <= 5 && 5 < hi {
+			return fail
+		}
+		return nil
+	})
+	if err != fail {
+		t.Errorf("got error %v, want %v", err, fail)
+	}
+}
+
+func TestNativeWorkers(t *testing.T) {
+	var evs []map[int]int
+	evs = append(evs, map[int]int{})
+	for id := 0; id < 8; id++ {
+		for s := 0; s < 2; s++ {
+			evs = append(evs, map[int]int{id: s}, map[int]int{id: s, (id + 3) % 8: 1 - s})
+		}
+	}
+	var logps [][]float64
+	var mars [][][][]float64
+	for _, workers := range []int{1, 4} {
+		b, err := NewBackend(Native, "../examples/asia.bif", "", workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logp, err := b.LogPR(evs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mar, err := b.(MARBackend).MAR(evs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logps, mars = append(logps, logp), append(mars, mar)
+	}
+	if len(logps[0]) != len(evs) || !reflect.DeepEqual(logps[0], logps[1]) {
+		t.Errorf("log-probabilities differ with 4 workers:\n%v\n%v", logps[0], logps[1])
+	}
+	if len(mars[0]) != len(evs) || !reflect.DeepEqual(mars[0], mars[1]) {
+		t.Errorf("marginals differ with 4 workers")
+	}
+}
+
+func TestNativeUAI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	evs := []map[int]int{{}, {0: 0}, {2: 1, 7: 0}, {5: 0, 6: 1}}
+	b, err := NewBackend(Native, "../examples/asia.bif", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := b.LogPR(evs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bayes files and markov files whose factors are conditional tables are both read
+	for _, typ := range []string{convert.UAIBayes, convert.UAIMarkov} {
+		uaiFile := filepath.Join(dir, "asia-"+typ+".uai")
+		if err := convert.Convert("../examples/asia.bif", uaiFile, "", "", "", convert.Options{UAIType: typ}); err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewBackend(Native, uaiFile, "", 1)
+		if err != nil {
+			t.Fatalf("%v: %v", typ, err)
+		}
+		got, err := b.LogPR(evs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-9 {
+				t.Errorf("%v: log-probabilities %v, want %v", typ, got, want)
+				break
+			}
+		}
+	}
+	potts := filepath.Join(dir, "potts.uai")
+	if err := ioutil.WriteFile(potts, []byte("MARKOV\n2\n2 2\n1\n2 0 1\n4\n2 1 1 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBackend(Native, potts, "", 1); err == nil {
+		t.Errorf("want error on a markov network that is not a bayesian network")
+	}
+}
+
+func TestBackendModel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { convert.CacheDir = d }(convert.CacheDir)
+	convert.CacheDir = filepath.Join(dir, "cache")
+	xmlFile := filepath.Join(dir, "asia.xml")
+	if err := convert.Convert("../examples/asia.bif", xmlFile, "", "", "", convert.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		mFile, format, ext string
+	}{
+		{"../examples/asia.bif", "uai", ".uai"},
+		{xmlFile, "uai", ".uai"},
+		{xmlFile, "fg", ".fg"},
+		{"asia.uai", "uai", ".uai"},
+	}
+	for _, tt := range cases {
+		got, err := backendModel(UAI2010, tt.mFile, tt.format)
+		if err != nil {
+			t.Errorf("%v to %v: %v", tt.mFile, tt.format, err)
+			continue
+		}
+		if filepath.Ext(got) != tt.ext {
+			t.Errorf("%v to %v: got %v", tt.mFile, tt.format, got)
+		}
+	}
+	for _, mFile := range []string{"asia.txt", "asia"} {
+		if _, err := NewBackend(LibDAI, mFile, "", 1); err == nil {
+			t.Errorf("%v: want error on unsupported model format", mFile)
+		}
+	}
+}
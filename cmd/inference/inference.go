@@ -4,147 +4,375 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/britojr/exp-run/cmd"
 	"github.com/britojr/exp-run/cmd/convert"
-	"github.com/britojr/utl/cmdsh"
-	"github.com/britojr/utl/conv"
-	"github.com/britojr/utl/errchk"
-	"github.com/britojr/utl/ioutl"
+	"github.com/britojr/exp-run/cmd/infkey"
 	"github.com/gonum/floats"
 )
 
+// inference tasks
+const (
+	PR  = "PR"
+	MAR = "MAR"
+	MPE = "MPE"
+	MAP = "MAP"
+)
+
+func Tasks() []string {
+	return []string{PR, MAR, MPE, MAP}
+}
+
 var Cmd = &cmd.Command{}
 
 func init() {
 	Cmd.Name = "infer"
 	Cmd.Short = "performs inference on a given model"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		mFile := cm.Flag.String("m", "", "input model in bif format")
-		qFile := cm.Flag.String("q", "", "query file")
-		evFile := cm.Flag.String("ev", "", "evidence file")
-		logFile := cm.Flag.String("log", "", "output file")
-		cm.Flag.Parse(args)
-		if len(*mFile) == 0 || len(*qFile) == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
+	Cmd.Long = `
+Infer runs an inference task for each line of the query/evidence files.
+PR writes the log-probability of each query conditioned on the evidence line
+with the same number; MAR writes the posterior marginals of every variable
+and MPE/MAP the most probable assignment given each evidence line (the query
+file is used as evidence when no evidence file is given).
+The native backend runs in process on any model convert reads as a bayesian
+network (bif, xml, net, fg, and uai files of conditional tables); the external
+backends call a solver on models converted and cached in the cache directory.`
+	Cmd.Examples = []string{
+		"infer -m asia.bif -q asia.q -ev asia.ev -log asia.infkey",
+		"infer -m asia.bif -ev asia.ev -task MAR -workers 4",
+		"infer -m asia.bif -ev asia.ev -task MAP -mapvars 1,3",
+		"infer -m asia.bif -q asia.q -ev asia.ev -backend uai2010",
+		"infer -m asia.uai -q asia.q -ev asia.ev -log asia.infkey",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	mFile := Cmd.Flag.String("m", "", "input model in bif format, or another format read by the backend")
+	qFile := Cmd.Flag.String("q", "", "query file")
+	evFile := Cmd.Flag.String("ev", "", "evidence file")
+	logFile := Cmd.Flag.String("log", "", "output file")
+	task := Cmd.Flag.String("task", PR, "inference task ("+strings.Join(Tasks(), "|")+"), MAR/MPE/MAP condition on the evidence file lines")
+	mapVars := Cmd.Flag.String("mapvars", "", "comma separated ids of the MAP variables")
+	backend := Cmd.Flag.String("backend", Native, "inference backend ("+strings.Join(Backends(), "|")+")")
+	cacheDir := Cmd.Flag.String("cache", convert.CacheDir, "directory of cached model conversions")
+	workers := Cmd.Flag.Int("workers", 1, "number of concurrent workers")
+	solver := Cmd.Flag.String("solver", "", "solver command for external backends (default depends on backend)")
+	Cmd.Required = []string{"m"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if len(*qFile) == 0 && (*task == PR || len(*evFile) == 0) {
+			return cmd.Usagef("task %v needs a query file", *task)
 		}
-		Infer(*mFile, *qFile, *evFile, *logFile)
+		convert.CacheDir = *cacheDir
+		return Infer(*mFile, *qFile, *evFile, *logFile, *task, *mapVars, *backend, *solver, *workers)
 	}
 }
 
-func Infer(mFile, qFile, evFile, logFile string) {
+func Infer(mFile, qFile, evFile, logFile, task, mapVars, backend, solver string, workers int) error {
 	basename := strings.TrimSuffix(mFile, filepath.Ext(mFile))
-	dainame := basename + ".uai"
-	switch filepath.Ext(mFile) {
-	case ".uai":
-	case ".xml":
-		convert.Convert(mFile, dainame, convert.Xml2uai, "", "", 0.0)
-	default:
-		convert.Convert(mFile, dainame, convert.Bif2uai, "", "", 0.0)
-	}
-	var probQev []float64
-	if len(evFile) != 0 {
-		daiEv, daiQu := dainame+".evid", dainame+".quer"
-		qevFile := dainame + ".temp"
-		defer os.Remove(qevFile)
-		mergeQev(qFile, evFile, qevFile)
-		convert.Convert(qevFile, daiQu, convert.Ev2evid, "", "", 0.0)
-		convert.Convert(evFile, daiEv, convert.Ev2evid, "", "", 0.0)
-		probQev = computeProb(dainame, daiQu)
-		probEv := computeProb(dainame, daiEv)
-		floats.Sub(probQev, probEv)
-		removePositive(probQev)
-	} else {
-		daiQu := dainame + ".quer"
-		convert.Convert(qFile, daiQu, convert.Ev2evid, "", "", 0.0)
-		probQev = computeProb(dainame, daiQu)
-	}
-	if len(logFile) == 0 {
-		writeProbs(basename+".infkey", probQev)
-	} else {
-		writeProbs(logFile, probQev)
-	}
-}
-
-func mergeQev(qFile, evFile, qevFile string) {
-	rq := ioutl.OpenFile(qFile)
-	defer rq.Close()
-	rev := ioutl.OpenFile(evFile)
-	defer rev.Close()
-	w := ioutl.CreateFile(qevFile)
-	defer w.Close()
-	scq := bufio.NewScanner(rq)
-	scev := bufio.NewScanner(rev)
-	for scq.Scan() {
-		scev.Scan()
-		line := strings.Split(scev.Text(), ",")
-		for i, v := range strings.Split(scq.Text(), ",") {
+	b, err := NewBackend(backend, mFile, solver, workers)
+	if err != nil {
+		return err
+	}
+	if len(evFile) == 0 && task != PR {
+		evFile = qFile
+	}
+	switch task {
+	case PR:
+		probQev, err := inferPR(b, qFile, evFile)
+		if err != nil {
+			return err
+		}
+		if len(logFile) == 0 {
+			logFile = basename + ".infkey"
+		}
+		return infkey.Write(logFile, probQev)
+	case MAR:
+		mb, ok := b.(MARBackend)
+		if !ok {
+			return fmt.Errorf("backend %v does not support %v", backend, task)
+		}
+		evs, err := readEvidLines(evFile)
+		if err != nil {
+			return err
+		}
+		mars, err := mb.MAR(evs)
+		if err != nil {
+			return err
+		}
+		if len(logFile) == 0 {
+			logFile = basename + ".mar"
+		}
+		return writeMar(logFile, mars)
+	case MPE, MAP:
+		mb, ok := b.(MAPBackend)
+		if !ok {
+			return fmt.Errorf("backend %v does not support %v", backend, task)
+		}
+		var mvs []int
+		if task == MAP {
+			if len(mapVars) == 0 {
+				return fmt.Errorf("%v task needs the list of map variables", task)
+			}
+			for _, v := range strings.Split(mapVars, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(v))
+				if err != nil {
+					return fmt.Errorf("invalid map variable: %v", err)
+				}
+				mvs = append(mvs, id)
+			}
+		}
+		evs, err := readEvidLines(evFile)
+		if err != nil {
+			return err
+		}
+		xs, probs, err := mb.MAP(evs, mvs)
+		if err != nil {
+			return err
+		}
+		if len(logFile) == 0 {
+			logFile = basename + "." + strings.ToLower(task)
+		}
+		return writeMPE(logFile, task, xs, probs)
+	}
+	return fmt.Errorf("invalid task option: (%v)", task)
+}
+
+// inferPR computes the log-probability of the queries, conditioned on the evidence if given
+func inferPR(b InferenceBackend, qFile, evFile string) ([]float64, error) {
+	qs, err := readEvidLines(qFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(evFile) == 0 {
+		return b.LogPR(qs)
+	}
+	evs, err := readEvidLines(evFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(evs) < len(qs) {
+		return nil, fmt.Errorf("fewer evidence (%v) than query (%v) lines", len(evs), len(qs))
+	}
+	evs = evs[:len(qs)]
+	// both batches go in a single call so they share the workers
+	probs, err := b.LogPR(append(mergeQev(qs, evs), evs...))
+	if err != nil {
+		return nil, err
+	}
+	probQev, probEv := probs[:len(qs)], probs[len(qs):]
+	floats.Sub(probQev, probEv)
+	removePositive(probQev)
+	return probQev, nil
+}
+
+// readEvidLines reads a file of comma separated states, with '*' for unobserved variables
+func readEvidLines(fname string) (evs []map[int]int, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	for ln := 1; scanner.Scan(); ln++ {
+		if len(scanner.Text()) == 0 {
+			continue
+		}
+		evid := make(map[int]int)
+		for i, v := range strings.Split(scanner.Text(), ",") {
 			if v != "*" {
-				line[i] = v
+				if evid[i], err = strconv.Atoi(v); err != nil {
+					return nil, fmt.Errorf("%v:%v: %v", fname, ln, err)
+				}
 			}
 		}
-		fmt.Fprintln(w, strings.Join(line, ","))
+		evs = append(evs, evid)
 	}
+	return evs, scanner.Err()
 }
 
-func computeProb(mdName, evName string) []float64 {
-	seed := time.Now().UnixNano()
-	cmdsh.ExecPrint(fmt.Sprintf(
-		"uai2010-aie-solver %s %s %v PR",
-		mdName, evName, seed,
-	), 0)
-	return parsePR(mdName + ".PR")
+// mergeQev returns the query rows extended with the evidence of the corresponding rows
+func mergeQev(qs, evs []map[int]int) []map[int]int {
+	qevs := make([]map[int]int, len(qs))
+	for i, q := range qs {
+		qevs[i] = make(map[int]int)
+		if i < len(evs) {
+			for id, s := range evs[i] {
+				qevs[i][id] = s
+			}
+		}
+		for id, s := range q {
+			qevs[i][id] = s
+		}
+	}
+	return qevs
 }
 
-func writeProbs(fname string, probs []float64) {
-	w := ioutl.CreateFile(fname)
+// writeMar writes one line of posterior marginals per evidence row in uai MAR format
+func writeMar(fname string, mars [][][]float64) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
 	defer w.Close()
-	sum := 0.0
-	for _, v := range probs {
-		sum += v
-		fmt.Fprintf(w, "%.8f\n", v)
+	fmt.Fprintln(w, MAR)
+	for _, ma := range mars {
+		fmt.Fprintf(w, "%v ", len(ma))
+		for _, dist := range ma {
+			fmt.Fprintf(w, "%v ", len(dist))
+			for _, p := range dist {
+				fmt.Fprintf(w, "%.7f ", p)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// writeMPE writes a header with the task name followed by one line per evidence row
+// with the log-probability and the comma separated assignment ('*' for unassigned variables)
+func writeMPE(fname, task string, xs [][]int, probs []float64) error {
+	w, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	fmt.Fprintln(w, task)
+	for i, x := range xs {
+		line := make([]string, len(x))
+		for j, s := range x {
+			if s < 0 {
+				line[j] = "*"
+			} else {
+				line[j] = strconv.Itoa(s)
+			}
+		}
+		fmt.Fprintf(w, "%.8f %s\n", probs[i], strings.Join(line, ","))
+	}
+	return nil
+}
+
+// wordScanner reads the whitespace separated fields of a solver output,
+// keeping the first conversion error
+type wordScanner struct {
+	*bufio.Scanner
+	fname string
+	err   error
+}
+
+func newWordScanner(r *os.File) *wordScanner {
+	sc := &wordScanner{Scanner: bufio.NewScanner(r), fname: r.Name()}
+	sc.Split(bufio.ScanWords)
+	return sc
+}
+
+func (sc *wordScanner) next() string {
+	if !sc.Scan() && sc.err == nil {
+		sc.err = fmt.Errorf("%v: unexpected end of file", sc.fname)
+	}
+	return sc.Text()
+}
+
+func (sc *wordScanner) atoi(w string) int {
+	v, err := strconv.Atoi(w)
+	if err != nil && sc.err == nil {
+		sc.err = fmt.Errorf("%v: %v", sc.fname, err)
+	}
+	return v
+}
+
+func (sc *wordScanner) atof(w string) float64 {
+	v, err := strconv.ParseFloat(w, 64)
+	if err != nil && sc.err == nil {
+		sc.err = fmt.Errorf("%v: %v", sc.fname, err)
+	}
+	return v
+}
+
+// parsePR reads the last solution block of a solver PR output
+func parsePR(fname string) (fs []float64, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
 	}
-	if len(probs) > 0 {
-		fmt.Fprintf(w, "avg = %.8f\n", sum/float64(len(probs)))
+	defer r.Close()
+	sc := newWordScanner(r)
+	sc.next() //read PR header
+	for sc.err == nil && sc.Scan() {
+		if strings.Index(sc.Text(), "BEGIN") >= 0 {
+			continue
+		}
+		fs = make([]float64, sc.atoi(sc.Text()))
+		for i := range fs {
+			fs[i] = sc.atof(sc.next())
+		}
 	}
+	return fs, sc.err
 }
 
-func parsePR(fname string) (fs []float64) {
-	r := ioutl.OpenFile(fname)
+// parseMAR reads the last solution block of a solver MAR output,
+// a count of evidence rows followed by the marginals of each row
+func parseMAR(fname string) (mars [][][]float64, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
 	defer r.Close()
-	scanner := bufio.NewScanner(r)
-	scanner.Scan() //read PR header
-	for scanner.Scan() {
-		if strings.Index(scanner.Text(), "BEGIN") >= 0 {
+	sc := newWordScanner(r)
+	sc.next() //read MAR header
+	for sc.err == nil && sc.Scan() {
+		if strings.Index(sc.Text(), "BEGIN") >= 0 {
 			continue
 		}
-		n := conv.Atoi(scanner.Text())
-		if len(fs) < n {
-			fs = make([]float64, n)
+		mars = make([][][]float64, sc.atoi(sc.Text()))
+		for i := range mars {
+			mars[i] = make([][]float64, sc.atoi(sc.next()))
+			for j := range mars[i] {
+				mars[i][j] = make([]float64, sc.atoi(sc.next()))
+				for k := range mars[i][j] {
+					mars[i][j][k] = sc.atof(sc.next())
+				}
+			}
+		}
+	}
+	return mars, sc.err
+}
+
+// parseMPE reads the last solution block of a solver MPE output,
+// a count of evidence rows followed by the number of variables and their states for each row
+func parseMPE(fname string) (xs [][]int, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	sc := newWordScanner(r)
+	sc.next() //read MPE header
+	for sc.err == nil && sc.Scan() {
+		if strings.Index(sc.Text(), "BEGIN") >= 0 {
+			continue
 		}
-		for i := 0; i < n; i++ {
-			scanner.Scan()
-			fs[i] = conv.Atof(scanner.Text())
+		xs = make([][]int, sc.atoi(sc.Text()))
+		for i := range xs {
+			xs[i] = make([]int, sc.atoi(sc.next()))
+			for j := range xs[i] {
+				xs[i][j] = sc.atoi(sc.next())
+			}
 		}
 	}
-	return
+	return xs, sc.err
 }
 
+// removePositive replaces invalid positive log-probabilities by -inf,
+// truncating to zero the ones that are within rounding error
 func removePositive(fs []float64) {
-	mInf, err := strconv.ParseFloat("-inf", 64)
-	errchk.Check(err, "")
 	for i, v := range fs {
-		if v > 0 {
-			fs[i] = mInf
+		if v > roundTol {
+			fs[i] = math.Inf(-1)
+		} else if v > 0 {
+			fs[i] = 0
 		}
 	}
 }
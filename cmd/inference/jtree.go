@@ -0,0 +1,231 @@
+package inference
+
+import (
+	"math"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/model"
+	"github.com/britojr/lkbn/vars"
+)
+
+// jtEngine computes posterior marginals on a bayesian network by message passing
+// on the junction tree induced by a variable elimination order
+type jtEngine struct {
+	bn       *model.BNet
+	cliques  []vars.VarList
+	parent   []int
+	children [][]int
+	home     map[int]int // clique assigned to each cpt (by child var id)
+	clqOf    map[int]int // a clique containing each variable
+}
+
+func newJTEngine(bn *model.BNet) *jtEngine {
+	var scopes []vars.VarList
+	for _, v := range bn.Variables() {
+		scopes = append(scopes, bn.Node(v).Potential().Variables())
+	}
+	ord := minDegreeOrder(bn.Variables(), scopes)
+	pos := make(map[int]int)
+	for i, v := range ord {
+		pos[v.ID()] = i
+	}
+	j := &jtEngine{
+		bn:       bn,
+		cliques:  eliminationCliques(ord, scopes),
+		parent:   make([]int, len(ord)),
+		children: make([][]int, len(ord)),
+		home:     make(map[int]int),
+		clqOf:    make(map[int]int),
+	}
+	for i, clq := range j.cliques {
+		// the parent is the clique of the first variable eliminated after this one
+		j.parent[i] = -1
+		for _, u := range clq {
+			if p := pos[u.ID()]; p > i && (j.parent[i] < 0 || p < j.parent[i]) {
+				j.parent[i] = p
+			}
+		}
+		if j.parent[i] >= 0 {
+			j.children[j.parent[i]] = append(j.children[j.parent[i]], i)
+		}
+		j.clqOf[ord[i].ID()] = i
+	}
+	for _, v := range bn.Variables() {
+		first := -1
+		for _, u := range bn.Node(v).Potential().Variables() {
+			if first < 0 || pos[u.ID()] < first {
+				first = pos[u.ID()]
+			}
+		}
+		j.home[v.ID()] = first
+	}
+	return j
+}
+
+// JTree computes exact posteriors of a bayesian network on a junction tree,
+// reading the current potentials of the network at every query
+type JTree struct {
+	j *jtEngine
+}
+
+// NewJTree builds the junction tree of the structure of the network
+func NewJTree(bn *model.BNet) *JTree {
+	return &JTree{newJTEngine(bn)}
+}
+
+// Families returns the posterior distribution of the family of every variable given
+// the evidence, indexed as the network variables, and the log-probability of the evidence
+func (t *JTree) Families(evid map[int]int) ([]*factor.Factor, float64) {
+	return t.j.families(evid)
+}
+
+// eliminationCliques returns, for each variable in the order,
+// the variable and its neighbours at the time it is eliminated
+func eliminationCliques(ord []*vars.Var, scopes []vars.VarList) []vars.VarList {
+	adj := make(map[int]vars.VarList)
+	for _, sc := range scopes {
+		for _, u := range sc {
+			for _, w := range sc {
+				if u.ID() != w.ID() {
+					nb := adj[u.ID()]
+					nb.Add(w)
+					adj[u.ID()] = nb
+				}
+			}
+		}
+	}
+	cliques := make([]vars.VarList, len(ord))
+	done := make(map[int]bool)
+	for i, v := range ord {
+		clq := vars.VarList{v}
+		for _, u := range adj[v.ID()] {
+			if !done[u.ID()] {
+				clq.Add(u)
+			}
+		}
+		for _, u := range clq {
+			for _, w := range clq {
+				if u.ID() != w.ID() {
+					nb := adj[u.ID()]
+					nb.Add(w)
+					adj[u.ID()] = nb
+				}
+			}
+		}
+		done[v.ID()] = true
+		cliques[i] = clq
+	}
+	return cliques
+}
+
+// marginals returns the posterior marginal of every variable given the evidence,
+// indexed as the network variables
+func (j *jtEngine) marginals(evid map[int]int) [][]float64 {
+	coll, down, _ := j.calibrate(evid)
+	mars := make([][]float64, len(j.bn.Variables()))
+	for k, v := range j.bn.Variables() {
+		i := j.clqOf[v.ID()]
+		mars[k] = marginalOf(times(coll[i], down[i]), v)
+	}
+	return mars
+}
+
+// families returns the posterior distribution of the family of every variable given
+// the evidence, indexed as the network variables, and the log-probability of the evidence
+func (j *jtEngine) families(evid map[int]int) ([]*factor.Factor, float64) {
+	coll, down, logp := j.calibrate(evid)
+	fams := make([]*factor.Factor, len(j.bn.Variables()))
+	for k, v := range j.bn.Variables() {
+		i := j.home[v.ID()]
+		family := j.bn.Node(v).Potential().Variables()
+		g := times(coll[i], down[i])
+		if g == nil {
+			g = factor.New(family...)
+		} else {
+			g = g.Copy().SumOut(g.Variables().Diff(family)...)
+		}
+		scale(g)
+		fams[k] = g
+	}
+	return fams, logp
+}
+
+// calibrate passes the messages of the junction tree given the evidence, returning
+// for each clique the product of its potential with the messages of its children
+// and the message of its parent, and the log-probability of the evidence
+func (j *jtEngine) calibrate(evid map[int]int) (coll, down []*factor.Factor, logp float64) {
+	n := len(j.cliques)
+	pots := make([]*factor.Factor, n)
+	for _, v := range j.bn.Variables() {
+		i := j.home[v.ID()]
+		pots[i] = times(pots[i], j.bn.Node(v).Potential().Copy().Reduce(evid))
+	}
+	// upward pass, children always precede parents in elimination order;
+	// messages are scaled, so the evidence probability is the product of the scales
+	coll = make([]*factor.Factor, n)
+	up := make([]*factor.Factor, n)
+	for i := 0; i < n; i++ {
+		g := pots[i]
+		for _, c := range j.children[i] {
+			g = times(g, up[c])
+		}
+		coll[i] = g
+		if g != nil {
+			logp += math.Log(sum(g.Values()))
+		}
+		if j.parent[i] >= 0 {
+			up[i] = j.project(g, i, j.parent[i])
+		}
+	}
+	// downward pass
+	down = make([]*factor.Factor, n)
+	for p := n - 1; p >= 0; p-- {
+		for _, i := range j.children[p] {
+			g := times(pots[p], down[p])
+			for _, c := range j.children[p] {
+				if c != i {
+					g = times(g, up[c])
+				}
+			}
+			down[i] = j.project(g, p, i)
+		}
+	}
+	return
+}
+
+// project sums out of g the variables of clique i not in clique k,
+// returning a scaled message (nil messages stand for constant ones)
+func (j *jtEngine) project(g *factor.Factor, i, k int) *factor.Factor {
+	if g == nil {
+		return nil
+	}
+	g = g.Copy().SumOut(j.cliques[i].Diff(j.cliques[k])...)
+	scale(g)
+	return g
+}
+
+// marginalOf returns the normalized distribution of v in g
+func marginalOf(g *factor.Factor, v *vars.Var) []float64 {
+	dist := make([]float64, v.NState())
+	if g == nil {
+		for k := range dist {
+			dist[k] = 1 / float64(v.NState())
+		}
+		return dist
+	}
+	g = g.Copy().SumOut(g.Variables().Diff(vars.VarList{v})...)
+	scale(g)
+	copy(dist, g.Values())
+	return dist
+}
+
+// times multiplies two factors treating nil as the identity
+func times(f, g *factor.Factor) *factor.Factor {
+	if f == nil {
+		return g
+	}
+	if g == nil {
+		return f
+	}
+	return f.Copy().Times(g)
+}
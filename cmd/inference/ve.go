@@ -0,0 +1,262 @@
+package inference
+
+import (
+	"math"
+
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/model"
+	"github.com/britojr/lkbn/vars"
+)
+
+// veEngine computes exact probabilities on a bayesian network by variable elimination
+type veEngine struct {
+	bn  *model.BNet
+	ord []*vars.Var
+}
+
+func newVEEngine(bn *model.BNet) *veEngine {
+	e := &veEngine{bn: bn}
+	var scopes []vars.VarList
+	for _, v := range bn.Variables() {
+		scopes = append(scopes, bn.Node(v).Potential().Variables())
+	}
+	e.ord = minDegreeOrder(bn.Variables(), scopes)
+	return e
+}
+
+// logPR returns the log-probability of the given evidence (map of var id to state)
+func (e *veEngine) logPR(evid map[int]int) float64 {
+	fs := make([]*factor.Factor, 0, len(e.ord))
+	for _, v := range e.bn.Variables() {
+		fs = append(fs, e.bn.Node(v).Potential().Copy().Reduce(evid))
+	}
+	logZ := 0.0
+	for _, v := range e.ord {
+		var g *factor.Factor
+		g, fs = multiplyContaining(v, fs)
+		if g == nil {
+			continue
+		}
+		g = g.SumOut(v)
+		s := scale(g)
+		if s == 0 {
+			return math.Inf(-1)
+		}
+		logZ += math.Log(s)
+		fs = append(fs, g)
+	}
+	for _, f := range fs {
+		s := sum(f.Values())
+		if s == 0 {
+			return math.Inf(-1)
+		}
+		logZ += math.Log(s)
+	}
+	return logZ
+}
+
+// multiplyContaining returns the product of the factors that contain v
+// and the list of remaining factors
+func multiplyContaining(v *vars.Var, fs []*factor.Factor) (*factor.Factor, []*factor.Factor) {
+	var g *factor.Factor
+	rest := fs[:0]
+	for _, f := range fs {
+		if f.Variables().FindByID(v.ID()) == nil {
+			rest = append(rest, f)
+			continue
+		}
+		if g == nil {
+			g = f.Copy()
+		} else {
+			g = g.Times(f)
+		}
+	}
+	return g, rest
+}
+
+// scale divides the values of f by their sum and returns the sum
+func scale(f *factor.Factor) float64 {
+	values := f.Values()
+	s := sum(values)
+	if s == 0 {
+		return 0
+	}
+	scaled := make([]float64, len(values))
+	for i, v := range values {
+		scaled[i] = v / s
+	}
+	f.SetValues(scaled)
+	return s
+}
+
+func sum(values []float64) (s float64) {
+	for _, v := range values {
+		s += v
+	}
+	return
+}
+
+// minDegreeOrder returns a greedy elimination order on the interaction graph
+// defined by the given scopes, always eliminating the variable with fewest neighbours
+func minDegreeOrder(vs vars.VarList, scopes []vars.VarList) []*vars.Var {
+	adj := make(map[int]map[int]bool)
+	for _, v := range vs {
+		adj[v.ID()] = make(map[int]bool)
+	}
+	for _, sc := range scopes {
+		for _, u := range sc {
+			for _, w := range sc {
+				if u.ID() != w.ID() {
+					adj[u.ID()][w.ID()] = true
+				}
+			}
+		}
+	}
+	ord := make([]*vars.Var, 0, len(vs))
+	done := make(map[int]bool)
+	for len(ord) < len(vs) {
+		var next *vars.Var
+		for _, v := range vs {
+			if done[v.ID()] {
+				continue
+			}
+			if next == nil || len(adj[v.ID()]) < len(adj[next.ID()]) {
+				next = v
+			}
+		}
+		nb := adj[next.ID()]
+		for u := range nb {
+			for w := range nb {
+				if u != w {
+					adj[u][w] = true
+				}
+			}
+			delete(adj[u], next.ID())
+		}
+		done[next.ID()] = true
+		ord = append(ord, next)
+	}
+	return ord
+}
+
+// maxLogPR returns the most probable assignment of mapVars (or of all variables if nil)
+// given the evidence, and the log-probability of that assignment together with the evidence;
+// the assignment is indexed by var id, with -1 for variables not in the explanation
+func (e *veEngine) maxLogPR(evid map[int]int, mapVars []int) ([]int, float64) {
+	isMap := make(map[int]bool)
+	for _, v := range e.bn.Variables() {
+		if _, ok := evid[v.ID()]; !ok && (mapVars == nil || contains(mapVars, v.ID())) {
+			isMap[v.ID()] = true
+		}
+	}
+	// sum out the other variables before maximizing the explanation ones
+	var ord []*vars.Var
+	for _, v := range e.ord {
+		if !isMap[v.ID()] {
+			ord = append(ord, v)
+		}
+	}
+	for _, v := range e.ord {
+		if isMap[v.ID()] {
+			ord = append(ord, v)
+		}
+	}
+	fs := make([]*factor.Factor, 0, len(ord))
+	for _, v := range e.bn.Variables() {
+		fs = append(fs, e.bn.Node(v).Potential().Copy().Reduce(evid))
+	}
+	type step struct {
+		v *vars.Var
+		g *factor.Factor
+	}
+	var trace []step
+	logZ := 0.0
+	for _, v := range ord {
+		var g *factor.Factor
+		g, fs = multiplyContaining(v, fs)
+		if g == nil {
+			continue
+		}
+		if isMap[v.ID()] {
+			trace = append(trace, step{v, g})
+			g = maxOut(g, v)
+		} else {
+			g = g.SumOut(v)
+		}
+		s := scale(g)
+		if s == 0 {
+			logZ = math.Inf(-1)
+		} else {
+			logZ += math.Log(s)
+		}
+		fs = append(fs, g)
+	}
+	for _, f := range fs {
+		logZ += math.Log(sum(f.Values()))
+	}
+
+	assign := make([]int, len(e.bn.Variables()))
+	for i := range assign {
+		assign[i] = -1
+	}
+	for i := len(trace) - 1; i >= 0; i-- {
+		v, g := trace[i].v, trace[i].g
+		base, stride, step := 0, 0, 1
+		for _, u := range g.Variables() {
+			if u.ID() == v.ID() {
+				stride = step
+			} else if x, ok := evid[u.ID()]; ok {
+				base += x * step
+			} else {
+				base += assign[u.ID()] * step
+			}
+			step *= u.NState()
+		}
+		best := 0
+		for k := 1; k < v.NState(); k++ {
+			if g.Values()[base+k*stride] > g.Values()[base+best*stride] {
+				best = k
+			}
+		}
+		assign[v.ID()] = best
+	}
+	for id, x := range evid {
+		if mapVars == nil || contains(mapVars, id) {
+			assign[id] = x
+		}
+	}
+	return assign, logZ
+}
+
+// maxOut returns a factor with v removed from f by maximization
+func maxOut(f *factor.Factor, v *vars.Var) *factor.Factor {
+	var rest []*vars.Var
+	stride, step := 0, 1
+	for _, u := range f.Variables() {
+		if u.ID() == v.ID() {
+			stride = step
+		} else {
+			rest = append(rest, u)
+		}
+		step *= u.NState()
+	}
+	block := stride * v.NState()
+	g := factor.NewZeroes(rest...)
+	values := make([]float64, len(f.Values())/v.NState())
+	for i, x := range f.Values() {
+		j := i%stride + (i/block)*stride
+		if x > values[j] {
+			values[j] = x
+		}
+	}
+	return g.SetValues(values)
+}
+
+func contains(xs []int, x int) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package inference
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/britojr/exp-run/cmd/convert"
+	"github.com/britojr/lkbn/model"
+)
+
+// bruteForcePR computes the probability of evidence by enumerating the joint distribution
+func bruteForcePR(bn *model.BNet, evid map[int]int) float64 {
+	vs := bn.Variables()
+	attrb := make(map[int]int)
+	total := 0.0
+	var enum func(i int)
+	enum = func(i int) {
+		if i == len(vs) {
+			p := 1.0
+			for _, v := range vs {
+				f := bn.Node(v).Potential()
+				idx, step := 0, 1
+				for _, u := range f.Variables() {
+					idx += attrb[u.ID()] * step
+					step *= u.NState()
+				}
+				p *= f.Values()[idx]
+			}
+			total += p
+			return
+		}
+		v := vs[i]
+		if s, ok := evid[v.ID()]; ok {
+			attrb[v.ID()] = s
+			enum(i + 1)
+			return
+		}
+		for s := 0; s < v.NState(); s++ {
+			attrb[v.ID()] = s
+			enum(i + 1)
+		}
+	}
+	enum(0)
+	return total
+}
+
+func TestLogPR(t *testing.T) {
+	bn, err := convert.ReadBNet("../examples/asia.bif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newVEEngine(bn)
+	cases := []map[int]int{
+		{},
+		{0: 0},
+		{7: 0},
+		{0: 0, 7: 1},
+		{2: 1, 6: 0, 7: 0},
+		{1: 0, 3: 0, 5: 1},
+	}
+	for _, evid := range cases {
+		want := math.Log(bruteForcePR(bn, evid))
+		got := e.logPR(evid)
+		if math.Abs(want-got) > 1e-9 && !(math.IsInf(want, -1) && math.IsInf(got, -1)) {
+			t.Errorf("wrong log-probability of %v, want %v, got %v", evid, want, got)
+		}
+	}
+}
+
+func TestMarginals(t *testing.T) {
+	bn, err := convert.ReadBNet("../examples/asia.bif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jt := newJTEngine(bn)
+	cases := []map[int]int{
+		{},
+		{0: 0},
+		{7: 0},
+		{2: 1, 6: 0, 7: 0},
+	}
+	for _, evid := range cases {
+		pe := bruteForcePR(bn, evid)
+		mars := jt.marginals(evid)
+		for i, v := range bn.Variables() {
+			for k := 0; k < v.NState(); k++ {
+				ext := map[int]int{v.ID(): k}
+				for id, s := range evid {
+					ext[id] = s
+				}
+				want := 0.0
+				if s, ok := evid[v.ID()]; !ok || s == k {
+					want = bruteForcePR(bn, ext) / pe
+				}
+				if math.Abs(want-mars[i][k]) > 1e-9 {
+					t.Errorf("wrong marginal of %v=%v given %v, want %v, got %v", v, k, evid, want, mars[i][k])
+				}
+			}
+		}
+	}
+}
+
+func TestFamilies(t *testing.T) {
+	bn, err := convert.ReadBNet("../examples/asia.bif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jt := NewJTree(bn)
+	cases := []map[int]int{
+		{},
+		{7: 0},
+		{2: 1, 6: 0, 7: 0},
+	}
+	for _, evid := range cases {
+		pe := bruteForcePR(bn, evid)
+		fams, logp := jt.Families(evid)
+		if math.Abs(math.Log(pe)-logp) > 1e-9 {
+			t.Errorf("wrong log-probability of %v, want %v, got %v", evid, math.Log(pe), logp)
+		}
+		for i, v := range bn.Variables() {
+			family := bn.Node(v).Potential().Variables()
+			if !fams[i].Variables().Equal(family) {
+				t.Fatalf("wrong family of %v: %v", v, fams[i].Variables())
+			}
+			for k, got := range fams[i].Values() {
+				ext := make(map[int]int)
+				for id, s := range evid {
+					ext[id] = s
+				}
+				idx := k
+				consistent := true
+				for _, u := range family {
+					s := idx % u.NState()
+					idx /= u.NState()
+					if e, ok := evid[u.ID()]; ok && e != s {
+						consistent = false
+					}
+					ext[u.ID()] = s
+				}
+				want := 0.0
+				if consistent {
+					want = bruteForcePR(bn, ext) / pe
+				}
+				if math.Abs(want-got) > 1e-9 {
+					t.Errorf("wrong posterior of family %v, cell %v given %v, want %v, got %v", family, k, evid, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestMaxLogPR(t *testing.T) {
+	bn, err := convert.ReadBNet("../examples/asia.bif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newVEEngine(bn)
+	cases := []struct {
+		evid    map[int]int
+		mapVars []int
+		want    []int
+	}{
+		{map[int]int{6: 1, 7: 0}, nil, []int{1, 1, 0, 1, 0, 1, 1, 0}},
+		{map[int]int{6: 1, 7: 0}, []int{1, 3}, []int{-1, 1, -1, 1, -1, -1, -1, -1}},
+	}
+	for _, tt := range cases {
+		got, logp := e.maxLogPR(tt.evid, tt.mapVars)
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("wrong assignment, want %v, got %v", tt.want, got)
+		}
+		evid := make(map[int]int)
+		for id, s := range tt.evid {
+			evid[id] = s
+		}
+		for id, s := range got {
+			if s >= 0 {
+				evid[id] = s
+			}
+		}
+		if want := math.Log(bruteForcePR(bn, evid)); math.Abs(want-logp) > 1e-9 {
+			t.Errorf("wrong log-probability of %v, want %v, got %v", got, want, logp)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package infkey reads and writes infkey files, the log-probability of each
+// query in its own line followed by an "avg = " trailer with their average
+package infkey
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// trailer is the prefix of the line with the average of the values
+const trailer = "avg ="
+
+// avgTol is the tolerance between the trailer and the average of the values read,
+// which are rounded when written
+const avgTol = 1e-6
+
+// Write writes the log-probabilities to a file, -Inf for impossible queries
+// and NaN for queries that could not be computed
+func Write(fname string, probs []float64) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if err := Encode(f, probs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Encode writes the log-probabilities and their average trailer to w
+func Encode(w io.Writer, probs []float64) error {
+	bw := bufio.NewWriter(w)
+	sum := 0.0
+	for _, v := range probs {
+		sum += v
+		fmt.Fprintf(bw, "%.8f\n", v)
+	}
+	if len(probs) > 0 {
+		fmt.Fprintf(bw, "%s %.8f\n", trailer, sum/float64(len(probs)))
+	}
+	return bw.Flush()
+}
+
+// Read reads the log-probabilities of a file
+func Read(fname string) ([]float64, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	probs, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fname, err)
+	}
+	return probs, nil
+}
+
+// Decode reads log-probabilities from r, one per line, accepting -Inf and NaN;
+// the average trailer is optional but, if present, must be the last line and
+// match the values read, so truncated files are reported
+func Decode(r io.Reader) (probs []float64, err error) {
+	scanner := bufio.NewScanner(r)
+	var avg *float64
+	for ln := 1; scanner.Scan(); ln++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if avg != nil {
+			return nil, fmt.Errorf("line %v: line after the %q trailer", ln, trailer)
+		}
+		if strings.HasPrefix(line, trailer) {
+			v, err := strconv.ParseFloat(strings.TrimSpace(line[len(trailer):]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid trailer: %q", ln, line)
+			}
+			avg = &v
+			continue
+		}
+		v, err := strconv.ParseFloat(line, 64)
+		if err != nil || math.IsInf(v, 1) {
+			return nil, fmt.Errorf("line %v: invalid log-probability: %q", ln, line)
+		}
+		probs = append(probs, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if avg != nil && !matchAvg(probs, *avg) {
+		return nil, fmt.Errorf("%q trailer %v does not match the average of %v values", trailer, *avg, len(probs))
+	}
+	return probs, nil
+}
+
+func matchAvg(probs []float64, avg float64) bool {
+	if len(probs) == 0 {
+		return false
+	}
+	sum := 0.0
+	for _, v := range probs {
+		sum += v
+	}
+	mean := sum / float64(len(probs))
+	switch {
+	case math.IsNaN(avg) || math.IsNaN(mean):
+		return math.IsNaN(avg) && math.IsNaN(mean)
+	case math.IsInf(avg, 0) || math.IsInf(mean, 0):
+		return avg == mean
+	}
+	return math.Abs(avg-mean) <= avgTol*math.Max(1, math.Abs(mean))
+}
+
+// CountNaN returns the number of NaN values
+func CountNaN(probs []float64) (n int) {
+	for _, v := range probs {
+		if math.IsNaN(v) {
+			n++
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package infkey
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	probs := []float64{-0.5, math.Inf(-1), -1.25, math.NaN(), 0}
+	var buf bytes.Buffer
+	if err := Encode(&buf, probs[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "-0.50000000\n-Inf\n-1.25000000\navg = -Inf\n"; buf.String() != want {
+		t.Errorf("wrong encoding, want:\n%v\ngot:\n%v", want, buf.String())
+	}
+	buf.Reset()
+	Encode(&buf, probs)
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(probs) || CountNaN(got) != 1 {
+		t.Fatalf("wrong values, want %v, got %v", probs, got)
+	}
+	for i, v := range probs {
+		if !math.IsNaN(v) && got[i] != v {
+			t.Errorf("wrong value %v, want %v, got %v", i, v, got[i])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		in  string
+		err string
+	}{
+		{"-0.5\n-1.5\n", ""},
+		{"-0.5\n-1.5\navg = -1.00000000\n", ""},
+		{"-0.5\n\n-1.5\n\navg = -1.00000000\n\n", ""},
+		{"-0.5\nabc\n-1.5\n", "line 2"},
+		{"-0.5\n+Inf\n", "line 2"},
+		{"-0.5\navg = -0.5\n-1.5\n", "line 3"},
+		{"-0.5\navg = -1.00000000\n", "does not match"},
+		{"-0.5\navg = x\n", "invalid trailer"},
+	}
+	for _, tt := range cases {
+		_, err := Decode(strings.NewReader(tt.in))
+		if len(tt.err) == 0 && err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+		}
+		if len(tt.err) != 0 && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%q: want error with %q, got %v", tt.in, tt.err, err)
+		}
+	}
+}
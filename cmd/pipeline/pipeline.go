@@ -0,0 +1,302 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/britojr/exp-run/cmd"
+	"github.com/britojr/exp-run/cmd/difcalc"
+	"github.com/britojr/exp-run/cmd/hidgen"
+	"github.com/britojr/exp-run/cmd/inference"
+	"github.com/britojr/exp-run/cmd/pmlearn"
+	"github.com/britojr/exp-run/cmd/qevgen"
+	"github.com/britojr/exp-run/cmd/results"
+	"github.com/britojr/exp-run/cmd/sample"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Spec declares the grid of an experiment
+type Spec struct {
+	// Dir is the directory where all outputs are written
+	Dir string `json:"dir" yaml:"dir"`
+	// Models are the ground truth networks in bif format
+	Models []string `json:"models" yaml:"models"`
+	// Train are the sizes of the training sets
+	Train []int `json:"train" yaml:"train"`
+	// Test is the size of the testing sets
+	Test int `json:"test" yaml:"test"`
+	// Seed is the random seed of the qevgen, sampling, hidgen and em steps (0 to use current
+	// time), with a fixed seed the queries, datasets and cuts are the same in every run
+	Seed int64 `json:"seed" yaml:"seed"`
+	// Cuts are the numbers of internal variables hidden from the training sets
+	Cuts []int `json:"cuts" yaml:"cuts"`
+	// Queries is the number of query/evidence lines
+	Queries int `json:"queries" yaml:"queries"`
+	// MaxLeafs is the max number of leafs used as evidence (-1 for all)
+	MaxLeafs int `json:"maxleafs" yaml:"maxleafs"`
+	// Learners are the parameter learning configurations
+	Learners []Learner `json:"learners" yaml:"learners"`
+	// Metrics are the distance functions between inference results
+	Metrics []string `json:"metrics" yaml:"metrics"`
+	// Backend is the inference backend
+	Backend string `json:"backend" yaml:"backend"`
+	// Workers is the number of concurrent inference and counting workers
+	Workers int `json:"workers" yaml:"workers"`
+	// Results is the file where a record of each distance is appended
+	Results string `json:"results" yaml:"results"`
+	// File is the spec file, set by ReadSpec; it is an input of every step,
+	// so editing the spec runs the grid again
+	File string `json:"-" yaml:"-"`
+}
+
+// Learner is a parameter learning configuration
+type Learner struct {
+	Name string `json:"name" yaml:"name"`
+	// Parents is the structure file in list of parents format, where
+	// {model}, {train} and {cut} are replaced by the values of each grid point
+	Parents string  `json:"parents" yaml:"parents"`
+	Alpha   float64 `json:"alpha" yaml:"alpha"`
+	// Prior is the pmlearn prior option, with the equivalent sample size (1 if not given)
+	// of bdeu and the hyperparameters file of dirichlet, where {model} is replaced as in Parents
+	Prior string  `json:"prior" yaml:"prior"`
+	ESS   float64 `json:"ess" yaml:"ess"`
+	Hyper string  `json:"hyper" yaml:"hyper"`
+	// EM learns by expectation-maximization, with the hidden variables of the cut as latent
+	EM       bool `json:"em" yaml:"em"`
+	Restarts int  `json:"restarts" yaml:"restarts"`
+}
+
+var Cmd = &cmd.Command{}
+
+func init() {
+	Cmd.Name = "pipeline"
+	Cmd.Short = "runs an experiment grid declared in a yaml/json spec"
+	Cmd.Long = `
+Pipeline expands the grid of models, training sizes, cuts and learners of a
+spec file into qevgen, infer, sample, hidgen, pmlearn and difcalc steps and
+runs them in order. Steps whose outputs are newer than their inputs, the spec
+file included, are skipped, so an interrupted pipeline can be resumed by
+running it again and an edited spec runs the grid again.`
+	Cmd.Examples = []string{
+		"pipeline -f experiment.yaml",
+		"pipeline -f experiment.json -n",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	specFile := Cmd.Flag.String("f", "", "experiment spec file (yaml or json)")
+	dryRun := Cmd.Flag.Bool("n", false, "only print the steps that would run")
+	Cmd.Required = []string{"f"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		s, err := ReadSpec(*specFile)
+		if err != nil {
+			return err
+		}
+		return Run(s, *dryRun)
+	}
+}
+
+// ReadSpec parses a spec file, in json if it has a .json extension or yaml otherwise
+func ReadSpec(fname string) (*Spec, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spec{Dir: ".", Test: 1000, Queries: 1000, MaxLeafs: -1, Backend: inference.Native, Workers: 1}
+	if filepath.Ext(fname) == ".json" {
+		err = json.Unmarshal(data, s)
+	} else {
+		err = yaml.Unmarshal(data, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fname, err)
+	}
+	s.File = fname
+	if len(s.Cuts) == 0 {
+		s.Cuts = []int{0}
+	}
+	for i := range s.Learners {
+		if s.Learners[i].ESS == 0 {
+			s.Learners[i].ESS = 1
+		}
+	}
+	return s, nil
+}
+
+// Run expands the grid of the spec and runs each step whose outputs are not up to date
+func Run(s *Spec, dryRun bool) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	for _, st := range Steps(s) {
+		if upToDate(st) {
+			log.Printf("up to date: %v\n", st.Name)
+			continue
+		}
+		log.Printf("running: %v\n", st.Name)
+		if !dryRun {
+			if err := st.Run(); err != nil {
+				return fmt.Errorf("%v: %v", st.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Step is a single command call of the pipeline
+type Step struct {
+	Name    string
+	Inputs  []string
+	Outputs []string
+	Run     func() error
+}
+
+// Steps expands the grid of the spec into an ordered list of steps,
+// each one depending on the spec file if it is known
+func Steps(s *Spec) (sts []Step) {
+	for _, mFile := range s.Models {
+		mFile := mFile
+		mName := strings.TrimSuffix(filepath.Base(mFile), filepath.Ext(mFile))
+		base := filepath.Join(s.Dir, mName)
+		qFile, evFile, refFile := base+".q", base+".ev", base+".infkey"
+
+		sts = append(sts, Step{
+			Name:    "qevgen " + mName,
+			Inputs:  []string{mFile},
+			Outputs: []string{qFile, evFile},
+			Run:     func() error { return qevgen.QevGenerate(mFile, base, "", s.Queries, s.MaxLeafs, s.Seed) },
+		}, Step{
+			Name:    "infer " + mName,
+			Inputs:  []string{mFile, qFile, evFile},
+			Outputs: []string{refFile},
+			Run: func() error {
+				return inference.Infer(mFile, qFile, evFile, refFile, inference.PR, "", s.Backend, "", s.Workers)
+			},
+		})
+
+		for _, nTrain := range s.Train {
+			nTrain := nTrain
+			dsBase := fmt.Sprintf("%s-n%d", base, nTrain)
+			sts = append(sts, Step{
+				Name:    "sample " + filepath.Base(dsBase),
+				Inputs:  []string{mFile},
+				Outputs: []string{dsBase + ".train", dsBase + ".hdr"},
+				Run: func() error {
+					return sample.Generate(mFile, dsBase, "", nTrain, s.Test, 0, 0, s.Seed)
+				},
+			})
+			for _, cut := range s.Cuts {
+				sts = append(sts, cutSteps(s, mFile, mName, dsBase, nTrain, cut, refFile, qFile, evFile)...)
+			}
+		}
+	}
+	if len(s.File) != 0 {
+		for i := range sts {
+			sts[i].Inputs = append(sts[i].Inputs, s.File)
+		}
+	}
+	return
+}
+
+// cutSteps returns the steps of a training set with cut hidden variables
+func cutSteps(s *Spec, mFile, mName, dsBase string, nTrain, cut int, refFile, qFile, evFile string) (sts []Step) {
+	dsName, hdrName := dsBase+".train", dsBase+".hdr"
+	cutBase, cutFile, fullHdr := dsBase, "", hdrName
+	if cut > 0 {
+		cutBase = fmt.Sprintf("%s-c%d", dsBase, cut)
+		cutFile = cutBase + ".cut"
+		trainFile := dsName
+		dsName, hdrName = cutBase+".train", ""
+		sts = append(sts, Step{
+			Name:    "hidgen " + filepath.Base(cutBase),
+			Inputs:  []string{mFile, trainFile},
+			Outputs: []string{cutFile, dsName},
+			Run: func() error {
+				if err := hidgen.GenerateCut(mFile, cutFile, cut, s.Seed); err != nil {
+					return err
+				}
+				return hidgen.ApplyCut(cutFile, trainFile, dsName)
+			},
+		})
+	}
+	r := strings.NewReplacer("{model}", mName, "{train}", strconv.Itoa(nTrain), "{cut}", strconv.Itoa(cut))
+	for _, l := range s.Learners {
+		lBase := cutBase + "-" + l.Name
+		parents, learned, infFile := r.Replace(l.Parents), lBase+".xml", lBase+".infkey"
+		l := l
+		inputs := []string{parents, dsName}
+		if len(l.Hyper) != 0 {
+			l.Hyper = r.Replace(l.Hyper)
+			inputs = append(inputs, l.Hyper)
+		}
+		if l.EM && len(cutFile) != 0 {
+			inputs = append(inputs, cutFile)
+		}
+		sts = append(sts, Step{
+			Name:    "pmlearn " + filepath.Base(lBase),
+			Inputs:  inputs,
+			Outputs: []string{learned},
+			Run: func() error {
+				prior, err := pmlearn.NewPrior(l.Prior, l.Alpha, l.ESS, l.Hyper)
+				if err != nil {
+					return err
+				}
+				if l.EM {
+					em := pmlearn.EM{Tol: 1e-6, MaxIter: 100, Restarts: l.Restarts, Seed: s.Seed}
+					_, err = pmlearn.ParmLearnEM(parents, learned, dsName, fullHdr, cutFile, prior, em)
+					return err
+				}
+				_, err = pmlearn.ParmLearn(parents, learned, dsName, hdrName, prior, s.Workers)
+				return err
+			},
+		}, Step{
+			Name:    "infer " + filepath.Base(lBase),
+			Inputs:  []string{learned, qFile, evFile},
+			Outputs: []string{infFile},
+			Run: func() error {
+				return inference.Infer(learned, qFile, evFile, infFile, inference.PR, "", s.Backend, "", s.Workers)
+			},
+		})
+		for _, metric := range s.Metrics {
+			metric := metric
+			distFile := lBase + "." + metric
+			rec := results.Record{Model: mName, Learner: l.Name, Train: nTrain, Test: s.Test, Cut: cut}
+			sts = append(sts, Step{
+				Name:    "difcalc " + filepath.Base(distFile),
+				Inputs:  []string{refFile, infFile},
+				Outputs: []string{distFile},
+				Run: func() error {
+					_, err := difcalc.CalcDist(refFile, infFile, distFile, metric, s.Results, rec)
+					return err
+				},
+			})
+		}
+	}
+	return
+}
+
+// upToDate reports whether all outputs of the step exist and are newer than its inputs
+func upToDate(st Step) bool {
+	var newest int64
+	for _, name := range st.Inputs {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return false
+		}
+		if t := fi.ModTime().UnixNano(); t > newest {
+			newest = t
+		}
+	}
+	for _, name := range st.Outputs {
+		fi, err := os.Stat(name)
+		if err != nil || fi.ModTime().UnixNano() < newest {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/britojr/exp-run/cmd/inference"
+)
+
+func testSpec() *Spec {
+	return &Spec{
+		Dir:    "out",
+		Models: []string{"nets/asia.bif"},
+		Train:  []int{100, 200},
+		Test:   50,
+		Cuts:   []int{0, 1},
+		Learners: []Learner{
+			{Name: "ml", Parents: "{model}.parents"},
+			{Name: "em", Parents: "{model}-n{train}-c{cut}.parents", EM: true},
+		},
+		Metrics: []string{"hel", "kl"},
+	}
+}
+
+func TestSteps(t *testing.T) {
+	var names []string
+	byName := make(map[string]Step)
+	for _, st := range Steps(testSpec()) {
+		names = append(names, st.Name)
+		byName[st.Name] = st
+	}
+	learnerSteps := func(base string) []string {
+		var sts []string
+		for _, l := range []string{"ml", "em"} {
+			sts = append(sts, "pmlearn "+base+"-"+l, "infer "+base+"-"+l,
+				"difcalc "+base+"-"+l+".hel", "difcalc "+base+"-"+l+".kl")
+		}
+		return sts
+	}
+	want := []string{"qevgen asia", "infer asia"}
+	for _, n := range []string{"n100", "n200"} {
+		want = append(want, "sample asia-"+n)
+		want = append(want, learnerSteps("asia-"+n)...)
+		want = append(want, "hidgen asia-"+n+"-c1")
+		want = append(want, learnerSteps("asia-"+n+"-c1")...)
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("steps:\n%v\nwant:\n%v", strings.Join(names, "\n"), strings.Join(want, "\n"))
+	}
+
+	out := func(name string) string { return filepath.Join("out", name) }
+	cases := []struct {
+		name            string
+		inputs, outputs []string
+	}{
+		{"qevgen asia", []string{"nets/asia.bif"}, []string{out("asia.q"), out("asia.ev")}},
+		{"infer asia", []string{"nets/asia.bif", out("asia.q"), out("asia.ev")}, []string{out("asia.infkey")}},
+		{"sample asia-n100", []string{"nets/asia.bif"}, []string{out("asia-n100.train"), out("asia-n100.hdr")}},
+		{"pmlearn asia-n100-ml", []string{"asia.parents", out("asia-n100.train")}, []string{out("asia-n100-ml.xml")}},
+		{"hidgen asia-n200-c1", []string{"nets/asia.bif", out("asia-n200.train")},
+			[]string{out("asia-n200-c1.cut"), out("asia-n200-c1.train")}},
+		{"pmlearn asia-n200-c1-em", []string{"asia-n200-c1.parents", out("asia-n200-c1.train"), out("asia-n200-c1.cut")},
+			[]string{out("asia-n200-c1-em.xml")}},
+		{"infer asia-n200-c1-em", []string{out("asia-n200-c1-em.xml"), out("asia.q"), out("asia.ev")},
+			[]string{out("asia-n200-c1-em.infkey")}},
+		{"difcalc asia-n200-c1-ml.kl", []string{out("asia.infkey"), out("asia-n200-c1-ml.infkey")},
+			[]string{out("asia-n200-c1-ml.kl")}},
+	}
+	for _, tt := range cases {
+		st := byName[tt.name]
+		if !reflect.DeepEqual(st.Inputs, tt.inputs) || !reflect.DeepEqual(st.Outputs, tt.outputs) {
+			t.Errorf("%v: inputs %v outputs %v, want %v and %v", tt.name, st.Inputs, st.Outputs, tt.inputs, tt.outputs)
+		}
+	}
+
+	// editing the spec file makes every step out of date
+	s := testSpec()
+	s.File = "spec.yaml"
+	for _, st := range Steps(s) {
+		if in := st.Inputs; len(in) == 0 || in[len(in)-1] != "spec.yaml" {
+			t.Errorf("%v: inputs %v without the spec file", st.Name, in)
+		}
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	touch := func(name string, age time.Duration) string {
+		fname := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fname, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fname, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+	in1, in2 := touch("in1", 3*time.Hour), touch("in2", 2*time.Hour)
+	newer, older := touch("newer", time.Hour), touch("older", 150*time.Minute)
+	missing := filepath.Join(dir, "missing")
+	cases := []struct {
+		inputs, outputs []string
+		want            bool
+	}{
+		{[]string{in1, in2}, []string{newer}, true},
+		{[]string{in1}, []string{older}, true},
+		{[]string{in1, in2}, []string{newer, older}, false},
+		{[]string{in1, in2}, []string{missing}, false},
+		{[]string{in1, missing}, []string{newer}, false},
+		{nil, []string{older}, true},
+	}
+	for i, tt := range cases {
+		if got := upToDate(Step{Inputs: tt.inputs, Outputs: tt.outputs}); got != tt.want {
+			t.Errorf("case %v: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestReadSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"spec.yaml": "models: [asia.bif]\ntrain: [100]\nlearners:\n  - name: bd\n    prior: bdeu\n  - name: k2\n    ess: 5\n",
+		"spec.json": `{"models": ["asia.bif"], "train": [100], "learners": [{"name": "bd", "prior": "bdeu"}, {"name": "k2", "ess": 5}]}`,
+	}
+	for name, content := range files {
+		fname := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ReadSpec(fname)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		want := &Spec{
+			File: fname, Dir: ".", Models: []string{"asia.bif"}, Train: []int{100}, Test: 1000, Cuts: []int{0},
+			Queries: 1000, MaxLeafs: -1, Backend: inference.Native, Workers: 1,
+			Learners: []Learner{{Name: "bd", Prior: "bdeu", ESS: 1}, {Name: "k2", ESS: 5}},
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("%v: got %+v, want %+v", name, s, want)
+		}
+	}
+	if _, err := ReadSpec(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("want error on missing spec")
+	}
+}
@@ -0,0 +1,176 @@
+package pmlearn
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/britojr/lkbn/vars"
+)
+
+// Dataset is a complete dataset held by column, the states of each variable
+// in a dense slice, so counting does not go through a map per row
+type Dataset struct {
+	vs   vars.VarList
+	cols map[int][]int32
+	n    int
+}
+
+// NewDataset returns the columns of the given variables of a list of rows
+func NewDataset(vs vars.VarList, rows []map[int]int) *Dataset {
+	d := &Dataset{vs: vs, cols: make(map[int][]int32), n: len(rows)}
+	for _, v := range vs {
+		col := make([]int32, len(rows))
+		for i, row := range rows {
+			col[i] = int32(row[v.ID()])
+		}
+		d.cols[v.ID()] = col
+	}
+	return d
+}
+
+// ReadDataset reads a comma separated dataset whose columns are the given variables;
+// without variables, one is created for each column with the cardinality given
+// by its largest value
+func ReadDataset(fname string, vs vars.VarList) (*Dataset, error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var cols [][]int32
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for ln := 1; scanner.Scan(); ln++ {
+		text := scanner.Text()
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if cols == nil {
+			if vs != nil && len(fields) != len(vs) {
+				return nil, fmt.Errorf("%v: line %v: %v columns, want %v", fname, ln, len(fields), len(vs))
+			}
+			cols = make([][]int32, len(fields))
+		}
+		if len(fields) != len(cols) {
+			return nil, fmt.Errorf("%v: line %v: %v columns, want %v", fname, ln, len(fields), len(cols))
+		}
+		for j, f := range fields {
+			x, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || x < 0 || (vs != nil && x >= vs[j].NState()) {
+				return nil, fmt.Errorf("%v: line %v: invalid value %q of column %v", fname, ln, f, j)
+			}
+			cols[j] = append(cols[j], int32(x))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: %v", fname, err)
+	}
+	if vs == nil {
+		for j, col := range cols {
+			m := int32(0)
+			for _, x := range col {
+				if x > m {
+					m = x
+				}
+			}
+			vs = append(vs, vars.New(j, int(m)+1, "", false))
+		}
+	}
+	d := &Dataset{vs: vs, cols: make(map[int][]int32)}
+	for j, v := range vs {
+		if j < len(cols) {
+			d.cols[v.ID()], d.n = cols[j], len(cols[j])
+		}
+	}
+	return d, nil
+}
+
+// Variables returns the variables of the columns
+func (d *Dataset) Variables() vars.VarList {
+	return d.vs
+}
+
+// Column returns the states of the variable with the given id in each row
+func (d *Dataset) Column(id int) []int32 {
+	return d.cols[id]
+}
+
+// Len returns the number of rows
+func (d *Dataset) Len() int {
+	return d.n
+}
+
+// Count returns the counts of the states of each family, with the first variable of
+// a family varying fastest, in a single pass over the rows split among the workers
+func (d *Dataset) Count(families [][]*vars.Var, workers int) [][]float64 {
+	type index struct {
+		cols    [][]int32
+		strides []int
+	}
+	idxs := make([]index, len(families))
+	for i, family := range families {
+		step := 1
+		for _, v := range family {
+			idxs[i].cols = append(idxs[i].cols, d.cols[v.ID()])
+			idxs[i].strides = append(idxs[i].strides, step)
+			step *= v.NState()
+		}
+	}
+	newCounts := func() [][]float64 {
+		counts := make([][]float64, len(families))
+		for i, family := range families {
+			counts[i] = make([]float64, nCells(family))
+		}
+		return counts
+	}
+	count := func(counts [][]float64, lo, hi int) {
+		for r := lo; r < hi; r++ {
+			for i, ix := range idxs {
+				k := 0
+				for j, col := range ix.cols {
+					k += int(col[r]) * ix.strides[j]
+				}
+				counts[i][k]++
+			}
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	chunk := (d.n + workers - 1) / workers
+	if workers == 1 || chunk == 0 {
+		counts := newCounts()
+		count(counts, 0, d.n)
+		return counts
+	}
+	parts := make([][][]float64, 0, workers)
+	var wg sync.WaitGroup
+	for lo := 0; lo < d.n; lo += chunk {
+		hi := lo + chunk
+		if hi > d.n {
+			hi = d.n
+		}
+		part := newCounts()
+		parts = append(parts, part)
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			count(part, lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+	counts := parts[0]
+	for _, part := range parts[1:] {
+		for i := range counts {
+			for k, c := range part[i] {
+				counts[i][k] += c
+			}
+		}
+	}
+	return counts
+}
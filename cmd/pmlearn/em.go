@@ -0,0 +1,355 @@
+package pmlearn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/britojr/exp-run/cmd/convert"
+	"github.com/britojr/exp-run/cmd/hidgen"
+	"github.com/britojr/exp-run/cmd/inference"
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/model"
+	"github.com/britojr/lkbn/vars"
+)
+
+// EM configures the expectation-maximization of the parameters
+type EM struct {
+	// Tol is the relative improvement of the log-likelihood, or log-posterior with
+	// a prior, below which a run stops
+	Tol float64
+	// MaxIter is the maximum number of iterations of each run
+	MaxIter int
+	// Restarts is the number of runs besides the first one, each from random parameters
+	Restarts int
+	// Seed of the random parameters, the current time if zero
+	Seed int64
+	// Trace is the file where the objective of each iteration is written, if given
+	Trace string
+}
+
+// missing are the markers of missing values in a dataset
+var missing = map[string]bool{"*": true, "?": true}
+
+// ParmLearnEM learns the parameters of a network structure by expectation-maximization,
+// from a dataset with missing values and without the columns of the latent variables
+// listed in cutFile; latent variables need the header of the complete dataset
+func ParmLearnEM(inFile, outFile, dsname, hdrname, cutFile string, prior Prior, em EM) (*model.BNet, error) {
+	paMap, vNames, err := parseParentMat(inFile)
+	if err != nil {
+		return nil, err
+	}
+	var vs, cols vars.VarList
+	if len(hdrname) != 0 {
+		if vs, err = convert.ParseHeader(hdrname); err != nil {
+			return nil, err
+		}
+	} else if len(cutFile) != 0 {
+		return nil, fmt.Errorf("latent variables of %v need a header file", cutFile)
+	}
+	latent := make(map[int]bool)
+	if len(cutFile) != 0 {
+		xs, err := hidgen.ReadCut(cutFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range xs {
+			if vs.FindByID(x) == nil {
+				return nil, fmt.Errorf("%v: no variable %v in the header", cutFile, x)
+			}
+			latent[x] = true
+		}
+	}
+	for i, v := range vs {
+		if latent[v.ID()] {
+			vs[i] = vars.New(v.ID(), v.NState(), v.Name(), true)
+			continue
+		}
+		cols = append(cols, v)
+	}
+	cols, rows, err := readRows(dsname, cols)
+	if err != nil {
+		return nil, err
+	}
+	if len(hdrname) == 0 {
+		vs = cols
+	}
+	if err := nameVars(inFile, vs, vNames); err != nil {
+		return nil, err
+	}
+	bn := buildStruct(vs, paMap)
+	if _, err := emParms(bn, rows, prior, em); err != nil {
+		return nil, err
+	}
+	log.Printf("writing %v\n", outFile)
+	return bn, convert.WriteBNetXML(bn, outFile)
+}
+
+// readRows reads a comma separated dataset whose columns are the given variables,
+// leaving missing values out of the rows; without variables, one is created for
+// each column with the cardinality given by its largest value
+func readRows(fname string, cols vars.VarList) (vars.VarList, []map[int]int, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines [][]int
+	var maxs []int
+	for ln, text := range strings.Split(string(data), "\n") {
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if cols != nil && len(fields) != len(cols) {
+			return nil, nil, fmt.Errorf("%v: line %v: %v columns, want %v", fname, ln+1, len(fields), len(cols))
+		}
+		if maxs == nil {
+			maxs = make([]int, len(fields))
+		} else if len(fields) != len(maxs) {
+			return nil, nil, fmt.Errorf("%v: line %v: %v columns, want %v", fname, ln+1, len(fields), len(maxs))
+		}
+		line := make([]int, len(fields))
+		for j, f := range fields {
+			f = strings.TrimSpace(f)
+			if missing[f] {
+				line[j] = -1
+				continue
+			}
+			x, err := strconv.Atoi(f)
+			if err != nil || x < 0 || (cols != nil && x >= cols[j].NState()) {
+				return nil, nil, fmt.Errorf("%v: line %v: invalid value %q of column %v", fname, ln+1, f, j)
+			}
+			line[j] = x
+			if x > maxs[j] {
+				maxs[j] = x
+			}
+		}
+		lines = append(lines, line)
+	}
+	if cols == nil {
+		for j, m := range maxs {
+			cols = append(cols, vars.New(j, m+1, "", false))
+		}
+	}
+	rows := make([]map[int]int, len(lines))
+	for i, line := range lines {
+		rows[i] = make(map[int]int)
+		for j, x := range line {
+			if x >= 0 {
+				rows[i][cols[j].ID()] = x
+			}
+		}
+	}
+	return cols, rows, nil
+}
+
+// emParms sets the parameters of the network with the best log-likelihood, or
+// log-posterior with a prior, found by the runs of expectation-maximization,
+// and returns it
+func emParms(bn *model.BNet, rows []map[int]int, prior Prior, em EM) (float64, error) {
+	vs := bn.Variables()
+	alphas := make([][]float64, len(vs))
+	if prior != nil {
+		for i, v := range vs {
+			var err error
+			if alphas[i], err = prior(v, bn.Node(v).Potential().Variables()); err != nil {
+				return 0, err
+			}
+		}
+	}
+	seed := em.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("em with %v restarts and seed %v\n", em.Restarts, seed)
+	rnd := rand.New(rand.NewSource(seed))
+	objective, column := "log-likelihood", "loglik"
+	if prior != nil {
+		objective, column = "log-posterior", "logpost"
+	}
+	var trace io.Writer = ioutil.Discard
+	if len(em.Trace) != 0 {
+		f, err := os.Create(em.Trace)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		trace = w
+		fmt.Fprintf(trace, "restart\titeration\t%v\n", column)
+	}
+	evs, weights := groupRows(rows)
+	jt := inference.NewJTree(bn)
+	best := math.Inf(-1)
+	var bestPots []*factor.Factor
+	for r := 0; r <= em.Restarts; r++ {
+		randomParms(bn, rnd)
+		ll, it := emRun(bn, jt, evs, weights, alphas, em, func(it int, ll float64) {
+			fmt.Fprintf(trace, "%v\t%v\t%v\n", r, it, ll)
+		})
+		log.Printf("restart %v: %v %v after %v iterations\n", r, objective, ll, it)
+		if bestPots == nil || ll > best {
+			best, bestPots = ll, make([]*factor.Factor, len(vs))
+			for i, v := range vs {
+				bestPots[i] = bn.Node(v).Potential().Copy()
+			}
+		}
+	}
+	for i, v := range vs {
+		bn.Node(v).SetPotential(bestPots[i])
+	}
+	return best, nil
+}
+
+// emRun iterates from the current parameters until the objective improves less than the
+// tolerance, returning the objective of the final parameters and the number of iterations;
+// the objective is the log-likelihood, plus the log of the prior density if there is one,
+// and iteration 0 is the starting point
+func emRun(bn *model.BNet, jt *inference.JTree, evs []map[int]int, weights []float64,
+	alphas [][]float64, em EM, trace func(it int, ll float64)) (ll float64, it int) {
+	estep := func() ([][]float64, float64) {
+		counts, ll := expectedCounts(bn, jt, evs, weights)
+		return counts, ll + logPrior(bn, alphas)
+	}
+	counts, ll := estep()
+	trace(0, ll)
+	for it = 1; it <= em.MaxIter; it++ {
+		maximize(bn, counts, alphas)
+		var cur float64
+		counts, cur = estep()
+		trace(it, cur)
+		done := cur-ll <= em.Tol*math.Abs(ll)
+		ll = cur
+		if done {
+			return ll, it
+		}
+	}
+	return ll, em.MaxIter
+}
+
+// logPrior returns the log density, up to a constant, of the parameters under the
+// dirichlet prior whose mode is the posterior mean given the pseudo-counts alphas
+func logPrior(bn *model.BNet, alphas [][]float64) (lp float64) {
+	for i, v := range bn.Variables() {
+		values := bn.Node(v).Potential().Values()
+		for j, a := range alphas[i] {
+			if a != 0 {
+				lp += a * math.Log(values[j])
+			}
+		}
+	}
+	return
+}
+
+// expectedCounts returns the expected counts of the family of each variable
+// and the log-likelihood of the rows given the current parameters
+func expectedCounts(bn *model.BNet, jt *inference.JTree, evs []map[int]int, weights []float64) ([][]float64, float64) {
+	vs := bn.Variables()
+	counts := make([][]float64, len(vs))
+	for i, v := range vs {
+		counts[i] = make([]float64, len(bn.Node(v).Potential().Values()))
+	}
+	ll, skip := 0.0, 0
+	for k, evid := range evs {
+		fams, logp := jt.Families(evid)
+		if math.IsInf(logp, -1) {
+			skip++
+			continue
+		}
+		ll += weights[k] * logp
+		for i, f := range fams {
+			for j, p := range f.Values() {
+				counts[i][j] += weights[k] * p
+			}
+		}
+	}
+	if skip > 0 {
+		log.Printf("warning: %v distinct rows with zero probability\n", skip)
+	}
+	return counts, ll
+}
+
+// maximize sets each conditional table to the posterior mean given the expected counts
+func maximize(bn *model.BNet, counts, alphas [][]float64) {
+	for i, v := range bn.Variables() {
+		values := counts[i]
+		for j := range alphas[i] {
+			values[j] += alphas[i][j]
+		}
+		family := bn.Node(v).Potential().Variables()
+		condNormalize(values, family, v)
+		bn.Node(v).SetPotential(factor.New(family...).SetValues(values))
+	}
+}
+
+// randomParms draws every conditional distribution uniformly at random
+func randomParms(bn *model.BNet, rnd *rand.Rand) {
+	for _, v := range bn.Variables() {
+		family := bn.Node(v).Potential().Variables()
+		values := make([]float64, nCells(family))
+		for j := range values {
+			values[j] = -math.Log(1 - rnd.Float64())
+		}
+		condNormalize(values, family, v)
+		bn.Node(v).SetPotential(factor.New(family...).SetValues(values))
+	}
+}
+
+// condNormalize divides the values of each configuration of the parents of v by their sum,
+// configurations with zero sum get the uniform distribution
+func condNormalize(values []float64, family []*vars.Var, v *vars.Var) {
+	stride, r := strideOf(family, v), v.NState()
+	for base := 0; base < len(values); base += stride * r {
+		for off := base; off < base+stride; off++ {
+			s := 0.0
+			for k := 0; k < r; k++ {
+				s += values[off+k*stride]
+			}
+			for k := 0; k < r; k++ {
+				if s == 0 {
+					values[off+k*stride] = 1 / float64(r)
+				} else {
+					values[off+k*stride] /= s
+				}
+			}
+		}
+	}
+}
+
+// groupRows returns the distinct rows and the number of times each one occurs
+func groupRows(rows []map[int]int) (evs []map[int]int, weights []float64) {
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := rowKey(row)
+		if k, ok := index[key]; ok {
+			weights[k]++
+			continue
+		}
+		index[key] = len(evs)
+		evs, weights = append(evs, row), append(weights, 1)
+	}
+	return
+}
+
+func rowKey(row map[int]int) string {
+	ids := make([]int, 0, len(row))
+	for id := range row {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var b strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%d=%d,", id, row[id])
+	}
+	return b.String()
+}
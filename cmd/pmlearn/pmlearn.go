@@ -5,63 +5,141 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/britojr/exp-run/cmd"
 	"github.com/britojr/exp-run/cmd/convert"
-	"github.com/britojr/lkbn/data"
 	"github.com/britojr/lkbn/factor"
 	"github.com/britojr/lkbn/model"
 	"github.com/britojr/lkbn/vars"
-	"github.com/britojr/utl/ioutl"
 )
 
 var Cmd = &cmd.Command{}
 
 func init() {
 	Cmd.Name = "pmlearn"
-	Cmd.Short = "parameter learning with complete data"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		src := cm.Flag.String("i", "", "input file (in list of parents format)")
-		dst := cm.Flag.String("o", "", "output file (xml format)")
-		dsname := cm.Flag.String("d", "", "dataset file")
-		hdrname := cm.Flag.String("h", "", "header/schema file")
-		alpha := cm.Flag.Float64("alpha", 0, "smoothing constant to avoid zero probabilities")
-		cm.Flag.Parse(args)
-		if len(*src) == 0 || len(*dst) == 0 || len(*dsname) == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
+	Cmd.Short = "parameter learning, by em with missing values or latent variables"
+	Cmd.Long = `
+Pmlearn learns the conditional probability tables of a network structure
+from a dataset by maximum likelihood, optionally adding alpha to every count.
+The structure file has one line per variable in the format "name: parent,parent",
+with variables in the order of the dataset columns.
+
+With a prior the tables are the posterior mean of the dirichlet distribution:
+  bdeu       spreads the equivalent sample size -ess uniformly over the cells
+             of each family (ess/(q*r) with q parent configurations and r states)
+  k2         adds one to every cell
+  dirichlet  reads the hyperparameters from the -hyper file, one line per
+             variable in the format "name: a,a,..." with a single value for
+             every cell, one value per state, or one value per cell of the family
+             (first variable of the family varying fastest, by dataset column);
+             variables not listed get no pseudo-counts
+
+With -em the tables are learned by expectation-maximization, for datasets with
+missing values (marked with * or ?) or without the columns of latent variables.
+The latent variables are given by a cut file, as written by hidgen, together
+with the header of the complete dataset. Each run starts from random tables
+and stops when the log-likelihood improves less than -tol (relative) or after
+-maxiter iterations; the tables of the best of 1+restarts runs are written.
+With a prior the log-posterior (log-likelihood plus log prior density) is used
+in place of the log-likelihood.`
+	Cmd.Examples = []string{
+		"pmlearn -i asia.parents -d asia.train -h asia.hdr -o asia-learned.xml",
+		"pmlearn -i asia.parents -d asia.train -o asia-learned.xml -alpha 1",
+		"pmlearn -i asia.parents -d asia.train -o asia-learned.xml -prior bdeu -ess 10",
+		"pmlearn -i asia.parents -d asia.train -o asia-learned.xml -prior dirichlet -hyper asia.hyper",
+		"pmlearn -i asia.parents -d asia-c2.train -h asia.hdr -c asia-c2.cut -o asia-learned.xml -em -restarts 4 -trace asia.trace",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	src := Cmd.Flag.String("i", "", "input file (in list of parents format)")
+	dst := Cmd.Flag.String("o", "", "output file (xml format)")
+	dsname := Cmd.Flag.String("d", "", "dataset file")
+	hdrname := Cmd.Flag.String("h", "", "header/schema file")
+	alpha := Cmd.Flag.Float64("alpha", 0, "smoothing constant to avoid zero probabilities")
+	priorOpt := Cmd.Flag.String("prior", PriorNone, "prior {none|bdeu|k2|dirichlet}")
+	ess := Cmd.Flag.Float64("ess", 1, "equivalent sample size of the bdeu prior")
+	hyperFile := Cmd.Flag.String("hyper", "", "hyperparameters file of the dirichlet prior")
+	workers := Cmd.Flag.Int("workers", 1, "number of goroutines counting the dataset")
+	useEM := Cmd.Flag.Bool("em", false, "learn by expectation-maximization")
+	cutFile := Cmd.Flag.String("c", "", "cut file of latent variables (with -em)")
+	var em EM
+	Cmd.Flag.Float64Var(&em.Tol, "tol", 1e-6, "relative log-likelihood improvement to stop em")
+	Cmd.Flag.IntVar(&em.MaxIter, "maxiter", 100, "maximum number of em iterations")
+	Cmd.Flag.IntVar(&em.Restarts, "restarts", 0, "number of em restarts from random parameters")
+	Cmd.Flag.Int64Var(&em.Seed, "seed", 0, "random seed of the em runs")
+	Cmd.Flag.StringVar(&em.Trace, "trace", "", "file to write the log-likelihood (log-posterior with a prior) of each em iteration")
+	Cmd.Required = []string{"i", "o", "d"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		prior, err := NewPrior(*priorOpt, *alpha, *ess, *hyperFile)
+		if err != nil {
+			return cmd.Usagef("%v", err)
+		}
+		if !*useEM {
+			if len(*cutFile) != 0 {
+				return cmd.Usagef("-c needs -em")
+			}
+			_, err = ParmLearn(*src, *dst, *dsname, *hdrname, prior, *workers)
+			return err
+		}
+		if em.MaxIter < 1 || em.Restarts < 0 || em.Tol < 0 {
+			return cmd.Usagef("invalid em options")
 		}
-		ParmLearn(*src, *dst, *dsname, *hdrname, *alpha)
+		if len(*cutFile) != 0 && len(*hdrname) == 0 {
+			return cmd.Usagef("-c needs the header of the complete dataset (-h)")
+		}
+		_, err = ParmLearnEM(*src, *dst, *dsname, *hdrname, *cutFile, prior, em)
+		return err
 	}
 }
 
-func ParmLearn(inFile, outFile, dsname, hdrname string, alpha float64) {
-	paMap, vNames := parseParentMat(inFile)
-	ds := data.NewDataset(dsname, "", false)
+func ParmLearn(inFile, outFile, dsname, hdrname string, prior Prior, workers int) (*model.BNet, error) {
+	paMap, vNames, err := parseParentMat(inFile)
+	if err != nil {
+		return nil, err
+	}
 	var vs vars.VarList
 	if len(hdrname) != 0 {
-		vs = convert.ParseHeader(hdrname)
-	} else {
-		vs = ds.Variables()
+		if vs, err = convert.ParseHeader(hdrname); err != nil {
+			return nil, err
+		}
 	}
-	fmt.Println(vs)
-	for i, name := range vNames {
-		vs.FindByID(i).SetName(name)
+	ds, err := ReadDataset(dsname, vs)
+	if err != nil {
+		return nil, err
+	}
+	vs = ds.Variables()
+	if err := nameVars(inFile, vs, vNames); err != nil {
+		return nil, err
 	}
 	bn := buildStruct(vs, paMap)
-	learnParms(bn, ds.IntMaps(), alpha)
+	if err := learnParms(bn, ds, prior, workers); err != nil {
+		return nil, err
+	}
 	log.Printf("writing %v\n", outFile)
-	bn.Write(outFile)
+	return bn, convert.WriteBNetXML(bn, outFile)
 }
 
-func parseParentMat(fname string) (map[string][]string, []string) {
+// nameVars names the variables in the order of the structure file
+func nameVars(inFile string, vs vars.VarList, vNames []string) error {
+	for i, name := range vNames {
+		v := vs.FindByID(i)
+		if v == nil {
+			return fmt.Errorf("%v: more variables than the dataset (%v)", inFile, len(vs))
+		}
+		v.SetName(name)
+	}
+	return nil
+}
+
+func parseParentMat(fname string) (map[string][]string, []string, error) {
 	paMap := make(map[string][]string)
 	var vNames []string
-	r := ioutl.OpenFile(fname)
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer r.Close()
 	scanner := bufio.NewScanner(r)
 	paSep := "<-"
@@ -75,7 +153,7 @@ func parseParentMat(fname string) (map[string][]string, []string) {
 		vNames = append(vNames, line[0])
 		paMap[line[0]] = strings.Fields(line[1])
 	}
-	return paMap, vNames
+	return paMap, vNames, scanner.Err()
 }
 
 func buildStruct(vs vars.VarList, paMap map[string][]string) *model.BNet {
@@ -114,14 +192,22 @@ func buildStruct(vs vars.VarList, paMap map[string][]string) *model.BNet {
 	return bn
 }
 
-func learnParms(bn *model.BNet, ds []map[int]int, alpha float64) {
+func learnParms(bn *model.BNet, ds *Dataset, prior Prior, workers int) error {
+	var families [][]*vars.Var
 	for _, v := range bn.Variables() {
+		families = append(families, bn.Node(v).Potential().Variables())
+	}
+	counts := ds.Count(families, workers)
+	for i, v := range bn.Variables() {
 		nd := bn.Node(v)
-		family := nd.Potential().Variables()
-		values := countValues(ds, family)
-		if alpha > 0 {
-			for i := range values {
-				values[i] += alpha
+		family, values := families[i], counts[i]
+		if prior != nil {
+			alphas, err := prior(v, family)
+			if err != nil {
+				return err
+			}
+			for i := range alphas {
+				values[i] += alphas[i]
 			}
 		}
 		pjoint, err := factor.New(family...).SetValues(values).Normalize(v)
@@ -130,22 +216,9 @@ func learnParms(bn *model.BNet, ds []map[int]int, alpha float64) {
 		}
 		nd.SetPotential(pjoint)
 	}
+	return nil
 }
 
 func countValues(ds []map[int]int, vs []*vars.Var) []float64 {
-	strides := make(map[int]int)
-	step := 1
-	for _, v := range vs {
-		strides[v.ID()] = step
-		step *= v.NState()
-	}
-	count := make([]float64, step)
-	for _, line := range ds {
-		index := 0
-		for id, step := range strides {
-			index += line[id] * step
-		}
-		count[index]++
-	}
-	return count
+	return NewDataset(vs, ds).Count([][]*vars.Var{vs}, 1)[0]
 }
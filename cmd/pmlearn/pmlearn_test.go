@@ -1,10 +1,13 @@
 package pmlearn
 
 import (
+	"math"
+	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
 
+	"github.com/britojr/exp-run/cmd/inference"
 	"github.com/britojr/lkbn/factor"
 	"github.com/britojr/lkbn/model"
 	"github.com/britojr/lkbn/vars"
@@ -56,6 +59,72 @@ func TestCountValues(t *testing.T) {
 	}
 }
 
+func TestCount(t *testing.T) {
+	ds, families := randomDataset(1001, 8, 3)
+	want := make([][]float64, len(families))
+	rows := make([]map[int]int, ds.Len())
+	for r := range rows {
+		rows[r] = make(map[int]int)
+		for _, v := range ds.Variables() {
+			rows[r][v.ID()] = int(ds.cols[v.ID()][r])
+		}
+	}
+	for i, family := range families {
+		want[i] = make([]float64, nCells(family))
+		for _, row := range rows {
+			k, step := 0, 1
+			for _, v := range family {
+				k += row[v.ID()] * step
+				step *= v.NState()
+			}
+			want[i][k]++
+		}
+	}
+	for _, workers := range []int{1, 3, 16} {
+		got := ds.Count(families, workers)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("wrong counts with %v workers, want:\n%v\n!=\n%v\n", workers, want, got)
+		}
+	}
+}
+
+// randomDataset returns a dataset of n rows and m ternary variables
+// and the families of each variable with the two previous ones
+func randomDataset(n, m, k int) (*Dataset, [][]*vars.Var) {
+	rnd := rand.New(rand.NewSource(1))
+	var vs vars.VarList
+	for j := 0; j < m; j++ {
+		vs = append(vs, vars.New(j, k, "", false))
+	}
+	rows := make([]map[int]int, n)
+	for r := range rows {
+		rows[r] = make(map[int]int)
+		for _, v := range vs {
+			rows[r][v.ID()] = rnd.Intn(k)
+		}
+	}
+	var families [][]*vars.Var
+	for j := range vs {
+		lo := j - 2
+		if lo < 0 {
+			lo = 0
+		}
+		families = append(families, vs[lo:j+1])
+	}
+	return NewDataset(vs, rows), families
+}
+
+func benchmarkCount(b *testing.B, workers int) {
+	ds, families := randomDataset(100000, 30, 3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ds.Count(families, workers)
+	}
+}
+
+func BenchmarkCount1(b *testing.B) { benchmarkCount(b, 1) }
+func BenchmarkCount4(b *testing.B) { benchmarkCount(b, 4) }
+
 func TestLearnParms(t *testing.T) {
 	vs := []*vars.Var{
 		vars.New(0, 2, "", false),
@@ -95,7 +164,9 @@ func TestLearnParms(t *testing.T) {
 		{0, 1, 1, 0, 2.0 / 3.0, .5, 1.0 / 3.0, .5},
 		{.2, .8},
 	}
-	learnParms(bn, ds, 0)
+	if err := learnParms(bn, NewDataset(vs, ds), nil, 1); err != nil {
+		t.Fatal(err)
+	}
 	for _, v := range vs {
 		got := bn.Node(v).Potential().Values()
 		if !reflect.DeepEqual(result[v.ID()], got) {
@@ -145,3 +216,102 @@ func TestBuildStruct(t *testing.T) {
 		}
 	}
 }
+
+func TestPrior(t *testing.T) {
+	pa := vars.New(0, 3, "pa", false)
+	v := vars.New(1, 2, "v", false)
+	family := []*vars.Var{pa, v}
+	hyper := map[string][]float64{"v": {1, 2}, "pa": {.5}}
+	cases := []struct {
+		prior  Prior
+		v      *vars.Var
+		family []*vars.Var
+		result []float64
+	}{
+		{uniformPrior(1), v, family, []float64{1, 1, 1, 1, 1, 1}},
+		{bdeuPrior(12), v, family, []float64{2, 2, 2, 2, 2, 2}},
+		{bdeuPrior(6), pa, family[:1], []float64{2, 2, 2}},
+		{dirichletPrior(hyper), v, family, []float64{1, 1, 1, 2, 2, 2}},
+		{dirichletPrior(hyper), pa, family[:1], []float64{.5, .5, .5}},
+		{dirichletPrior(map[string][]float64{}), v, family, nil},
+	}
+	for _, tt := range cases {
+		got, err := tt.prior(tt.v, tt.family)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tt.result, got) {
+			t.Errorf("wrong pseudo-counts (%v), want:\n%v\n!=\n%v\n", tt.v, tt.result, got)
+		}
+	}
+	if _, err := dirichletPrior(map[string][]float64{"v": {1, 2, 3}})(v, family); err == nil {
+		t.Errorf("hyperparameters with wrong size accepted")
+	}
+}
+
+func TestEMParms(t *testing.T) {
+	x, y := vars.New(0, 2, "x", false), vars.New(1, 2, "y", false)
+	bn := buildStruct(vars.VarList{x, y}, map[string][]string{"x": {}, "y": {"x"}})
+	rows := []map[int]int{
+		{0: 0, 1: 0}, {0: 0, 1: 0}, {0: 0, 1: 1}, {0: 0},
+		{0: 1, 1: 1}, {0: 1, 1: 1}, {0: 1, 1: 1}, {0: 1, 1: 0}, {0: 1}, {0: 1},
+	}
+	// y is missing at random given x, so em converges to the counts of the observed cells
+	result := [][]float64{
+		{.4, .6},
+		{2.0 / 3.0, .25, 1.0 / 3.0, .75},
+	}
+	em := EM{Tol: 1e-12, MaxIter: 100, Restarts: 2, Seed: 1}
+	ll, err := emParms(bn, rows, nil, em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range bn.Variables() {
+		got := bn.Node(v).Potential().Values()
+		for i := range got {
+			if math.Abs(result[v.ID()][i]-got[i]) > 1e-6 {
+				t.Errorf("wrong parameters (%v), want:\n%v\n!=\n%v\n", v, result[v.ID()], got)
+				break
+			}
+		}
+	}
+	want := 4*math.Log(.4) + 6*math.Log(.6) +
+		2*math.Log(2.0/3.0) + math.Log(1.0/3.0) + math.Log(.25) + 3*math.Log(.75)
+	if math.Abs(want-ll) > 1e-6 {
+		t.Errorf("wrong log-likelihood, want %v, got %v", want, ll)
+	}
+}
+
+func TestEMRun(t *testing.T) {
+	x, y := vars.New(0, 2, "x", false), vars.New(1, 2, "y", false)
+	rows := []map[int]int{{0: 0, 1: 0}, {0: 0, 1: 1}, {0: 0}, {0: 1, 1: 1}, {0: 1}, {1: 0}}
+	evs, weights := groupRows(rows)
+	for _, prior := range []Prior{nil, uniformPrior(1)} {
+		bn := buildStruct(vars.VarList{x, y}, map[string][]string{"x": {}, "y": {"x"}})
+		alphas := make([][]float64, 2)
+		if prior != nil {
+			for i, v := range bn.Variables() {
+				alphas[i], _ = prior(v, bn.Node(v).Potential().Variables())
+			}
+		}
+		randomParms(bn, rand.New(rand.NewSource(1)))
+		jt := inference.NewJTree(bn)
+		var trace []float64
+		ll, it := emRun(bn, jt, evs, weights, alphas, EM{MaxIter: 3}, func(it int, ll float64) {
+			trace = append(trace, ll)
+		})
+		if it != 3 || len(trace) != 4 || ll != trace[3] {
+			t.Fatalf("prior %v: %v iterations, trace %v, returned %v", prior != nil, it, trace, ll)
+		}
+		for i := 1; i < len(trace); i++ {
+			if trace[i] < trace[i-1]-1e-12 {
+				t.Errorf("prior %v: objective decreases: %v", prior != nil, trace)
+			}
+		}
+		// the returned objective is the one of the final parameters
+		_, want := expectedCounts(bn, jt, evs, weights)
+		if want += logPrior(bn, alphas); math.Abs(want-ll) > 1e-12 {
+			t.Errorf("prior %v: returned %v, objective of the parameters %v", prior != nil, ll, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package pmlearn
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/britojr/lkbn/vars"
+)
+
+// Prior returns the dirichlet hyperparameters of the family of v, one pseudo-count
+// per cell in the order of the counts of the family, or nil for no pseudo-counts
+type Prior func(v *vars.Var, family []*vars.Var) ([]float64, error)
+
+// prior options
+const (
+	PriorNone      = "none"
+	PriorBDeu      = "bdeu"
+	PriorK2        = "k2"
+	PriorDirichlet = "dirichlet"
+)
+
+// NewPrior returns the prior of the given option:
+// none adds alpha to every cell (maximum likelihood if zero),
+// bdeu spreads the equivalent sample size ess uniformly over the cells of each family,
+// k2 adds one to every cell,
+// and dirichlet reads the hyperparameters of each variable from hyperFile
+func NewPrior(name string, alpha, ess float64, hyperFile string) (Prior, error) {
+	if alpha < 0 {
+		return nil, fmt.Errorf("invalid alpha: %v", alpha)
+	}
+	if alpha > 0 && name != PriorNone && len(name) != 0 {
+		return nil, fmt.Errorf("alpha cannot be combined with the %v prior", name)
+	}
+	switch name {
+	case PriorNone, "":
+		if alpha == 0 {
+			return nil, nil
+		}
+		return uniformPrior(alpha), nil
+	case PriorK2:
+		return uniformPrior(1), nil
+	case PriorBDeu:
+		if ess <= 0 {
+			return nil, fmt.Errorf("invalid equivalent sample size: %v", ess)
+		}
+		return bdeuPrior(ess), nil
+	case PriorDirichlet:
+		if len(hyperFile) == 0 {
+			return nil, fmt.Errorf("the %v prior needs a hyperparameters file", name)
+		}
+		hyper, err := readHyper(hyperFile)
+		if err != nil {
+			return nil, err
+		}
+		return dirichletPrior(hyper), nil
+	}
+	return nil, fmt.Errorf("invalid prior option: (%v)", name)
+}
+
+func uniformPrior(alpha float64) Prior {
+	return func(v *vars.Var, family []*vars.Var) ([]float64, error) {
+		return fill(make([]float64, nCells(family)), alpha), nil
+	}
+}
+
+// bdeuPrior gives ess/(q*r) to every cell, where q is the number of parent
+// configurations and r the number of states of the child
+func bdeuPrior(ess float64) Prior {
+	return func(v *vars.Var, family []*vars.Var) ([]float64, error) {
+		n := nCells(family)
+		return fill(make([]float64, n), ess/float64(n)), nil
+	}
+}
+
+// dirichletPrior gives the hyperparameters read for each variable,
+// variables without hyperparameters get no pseudo-counts
+func dirichletPrior(hyper map[string][]float64) Prior {
+	return func(v *vars.Var, family []*vars.Var) ([]float64, error) {
+		hs, ok := hyper[v.Name()]
+		if !ok {
+			return nil, nil
+		}
+		n := nCells(family)
+		alphas := make([]float64, n)
+		switch len(hs) {
+		case 1:
+			fill(alphas, hs[0])
+		case v.NState():
+			stride := strideOf(family, v)
+			for i := range alphas {
+				alphas[i] = hs[(i/stride)%v.NState()]
+			}
+		case n:
+			copy(alphas, hs)
+		default:
+			return nil, fmt.Errorf("%v: %v hyperparameters, want 1, %v (states) or %v (cells)",
+				v.Name(), len(hs), v.NState(), n)
+		}
+		return alphas, nil
+	}
+}
+
+// readHyper reads a hyperparameters file with one line per variable in the format
+// "name: a,a,...", with either a single value for every cell, one value per state
+// of the variable, or one value per cell of its family in the order of the counts
+func readHyper(fname string) (map[string][]float64, error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	hyper := make(map[string][]float64)
+	scanner := bufio.NewScanner(r)
+	for ln := 1; scanner.Scan(); ln++ {
+		line := strings.SplitN(scanner.Text(), ":", 2)
+		if len(line) < 2 {
+			continue
+		}
+		name := strings.TrimSpace(line[0])
+		if _, ok := hyper[name]; ok {
+			return nil, fmt.Errorf("%v: line %v: repeated variable %v", fname, ln, name)
+		}
+		for _, f := range strings.Fields(strings.Replace(line[1], ",", " ", -1)) {
+			a, err := strconv.ParseFloat(f, 64)
+			if err != nil || a < 0 {
+				return nil, fmt.Errorf("%v: line %v: invalid hyperparameter: %q", fname, ln, f)
+			}
+			hyper[name] = append(hyper[name], a)
+		}
+		if len(hyper[name]) == 0 {
+			return nil, fmt.Errorf("%v: line %v: no hyperparameters for %v", fname, ln, name)
+		}
+	}
+	return hyper, scanner.Err()
+}
+
+func nCells(family []*vars.Var) int {
+	n := 1
+	for _, v := range family {
+		n *= v.NState()
+	}
+	return n
+}
+
+// strideOf returns the distance between consecutive states of v in the cells of the family
+func strideOf(family []*vars.Var, v *vars.Var) int {
+	stride := 1
+	for _, u := range family {
+		if u.ID() == v.ID() {
+			break
+		}
+		stride *= u.NState()
+	}
+	return stride
+}
+
+func fill(xs []float64, a float64) []float64 {
+	for i := range xs {
+		xs[i] = a
+	}
+	return xs
+}
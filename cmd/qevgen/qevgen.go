@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -14,85 +15,111 @@ import (
 	"github.com/britojr/bnutils/bif"
 	"github.com/britojr/exp-run/cmd"
 	"github.com/britojr/lkbn/vars"
-	"github.com/britojr/utl/errchk"
-	"github.com/britojr/utl/ioutl"
 )
 
-var randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 var Cmd = &cmd.Command{}
 
 func init() {
 	Cmd.Name = "qevgen"
 	Cmd.Short = "query and evidence generator"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		bifFile := cm.Flag.String("m", "", "input model in bif format")
-		out := cm.Flag.String("o", "", "basename of file to write q/ev format")
-		sample := cm.Flag.String("s", "", "sample in csv format")
-		num := cm.Flag.Int("n", 1, "number of queries/evidences to generate")
-		maxLfs := cm.Flag.Int("maxlfs", -1, "max number of leafs to use as evidence")
-		cm.Flag.Parse(args)
-		if len(*bifFile) == 0 || len(*out) == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
-		}
-		QevGenerate(*bifFile, *out, *sample, *num, *maxLfs)
+	Cmd.Long = `
+Qevgen writes a query file (.q) and an evidence file (.ev) with one line per query,
+each query sets a root variable and the evidence sets up to maxlfs leaf variables,
+unobserved variables are written as '*'. States are taken from the lines of the
+sample file when given, or drawn uniformly otherwise.`
+	Cmd.Examples = []string{
+		"qevgen -m asia.bif -o asia -n 1000",
+		"qevgen -m asia.bif -o asia -s asia.test -maxlfs 2",
+		"qevgen -m asia.bif -o asia -n 1000 -seed 7",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	bifFile := Cmd.Flag.String("m", "", "input model in bif format")
+	out := Cmd.Flag.String("o", "", "basename of file to write q/ev format")
+	sample := Cmd.Flag.String("s", "", "sample in csv format")
+	num := Cmd.Flag.Int("n", 1, "number of queries/evidences to generate")
+	maxLfs := Cmd.Flag.Int("maxlfs", -1, "max number of leafs to use as evidence")
+	seed := Cmd.Flag.Int64("seed", 0, "random seed (0 to use current time)")
+	Cmd.Required = []string{"m", "o"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		return QevGenerate(*bifFile, *out, *sample, *num, *maxLfs, *seed)
 	}
 }
 
-func QevGenerate(inpFile, outFile, sampFile string, num, maxLfs int) {
+// QevGenerate writes num query and evidence lines for the model, the same seed
+// giving the same files (0 to use current time)
+func QevGenerate(inpFile, outFile, sampFile string, num, maxLfs int, seed int64) error {
 	b, err := bif.ParseStruct(inpFile)
-	errchk.Check(err, "")
-	fq := ioutl.CreateFile(outFile + ".q")
-	log.Printf("create %v\n", fq.Name())
-	fev := ioutl.CreateFile(outFile + ".ev")
-	log.Printf("create %v\n", fev.Name())
+	if err != nil {
+		return err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	fq, err := os.Create(outFile + ".q")
+	if err != nil {
+		return err
+	}
 	defer fq.Close()
+	log.Printf("create %v\n", fq.Name())
+	fev, err := os.Create(outFile + ".ev")
+	if err != nil {
+		return err
+	}
 	defer fev.Close()
+	log.Printf("create %v\n", fev.Name())
 	tot := 0
 	if len(sampFile) != 0 {
-		scanner := bufio.NewScanner(ioutl.OpenFile(sampFile))
+		fs, err := os.Open(sampFile)
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		scanner := bufio.NewScanner(fs)
 		for scanner.Scan() {
 			read := strings.Split(scanner.Text(), ",")
-			sampleLine(b, fq, fev, read, maxLfs)
+			sampleLine(b, fq, fev, read, maxLfs, rnd)
 			tot++
 		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
 	}
 	for i := 0; i < (num - tot); i++ {
-		sampleLine(b, fq, fev, nil, maxLfs)
+		sampleLine(b, fq, fev, nil, maxLfs, rnd)
 	}
+	return nil
 }
 
-func sampleLine(b *bif.Struct, fq, fev io.Writer, read []string, maxLfs int) {
+func sampleLine(b *bif.Struct, fq, fev io.Writer, read []string, maxLfs int, rnd *rand.Rand) {
 	write := make([]string, len(b.Variables()))
-	v := sampleVar(b.Roots())
-	write[v.ID()] = sampleState(v, read)
+	v := sampleVar(b.Roots(), rnd)
+	write[v.ID()] = sampleState(v, read, rnd)
 	writeLine(fq, write)
 	write[v.ID()] = ""
 	lfs := b.Leafs()
 	if maxLfs < 0 || maxLfs > len(lfs) {
 		maxLfs = len(lfs)
 	} else {
-		randSource.Shuffle(len(lfs), func(i int, j int) {
+		rnd.Shuffle(len(lfs), func(i int, j int) {
 			lfs[i], lfs[j] = lfs[j], lfs[i]
 		})
 	}
 	for _, w := range lfs[:maxLfs] {
-		write[w.ID()] = sampleState(w, read)
+		write[w.ID()] = sampleState(w, read, rnd)
 	}
 	writeLine(fev, write)
 }
 
-func sampleVar(vs vars.VarList) *vars.Var {
-	return vs[randSource.Intn(len(vs))]
+func sampleVar(vs vars.VarList, rnd *rand.Rand) *vars.Var {
+	return vs[rnd.Intn(len(vs))]
 }
 
-func sampleState(v *vars.Var, line []string) string {
+func sampleState(v *vars.Var, line []string, rnd *rand.Rand) string {
 	if len(line) > 0 {
 		return line[v.ID()]
 	}
-	return strconv.Itoa(randSource.Intn(v.NState()))
+	return strconv.Itoa(rnd.Intn(v.NState()))
 }
 
 func writeLine(w io.Writer, line []string) {
@@ -0,0 +1,154 @@
+package report
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/britojr/exp-run/cmd"
+	"github.com/britojr/exp-run/cmd/results"
+	"gonum.org/v1/gonum/stat"
+)
+
+// record fields that can be used as table rows
+var rowFields = []string{"model", "learner", "train", "test", "cut", "version"}
+
+var Cmd = &cmd.Command{}
+
+func init() {
+	Cmd.Name = "report"
+	Cmd.Short = "summarize results records in tables"
+	Cmd.Long = `
+Report reads the records appended by difcalc and writes a table with one
+row per combination of the row fields and one column per metric, each cell
+with the mean, standard deviation and number of records.`
+	Cmd.Examples = []string{
+		"report -i results.jsonl",
+		"report -i results.csv -rows model,train -o table.txt",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	resFile := Cmd.Flag.String("i", "", "results file (.csv or .jsonl)")
+	outFile := Cmd.Flag.String("o", "", "output file")
+	rows := Cmd.Flag.String("rows", "model,learner,train,cut", "comma separated fields grouped in rows ("+strings.Join(rowFields, "|")+")")
+	Cmd.Required = []string{"i"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		return Report(*resFile, *outFile, strings.Split(*rows, ","))
+	}
+}
+
+// Report writes a table with one row per configuration and one column per metric,
+// with the mean and standard deviation of the values of each cell
+func Report(resFile, outFile string, rows []string) error {
+	for _, name := range rows {
+		if _, ok := field(results.Record{}, name); !ok {
+			return fmt.Errorf("invalid row field: (%v)", name)
+		}
+	}
+	rs, err := results.Read(resFile)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if len(outFile) != 0 {
+		f, err := os.Create(outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return writeTable(w, rs, rows)
+}
+
+func writeTable(w io.Writer, rs []results.Record, rows []string) error {
+	cells := make(map[string]map[string][]float64)
+	var keys [][]string
+	var metrics []string
+	for _, r := range rs {
+		key := make([]string, len(rows))
+		for i, name := range rows {
+			key[i], _ = field(r, name)
+		}
+		k := strings.Join(key, "\t")
+		if _, ok := cells[k]; !ok {
+			cells[k] = make(map[string][]float64)
+			keys = append(keys, key)
+		}
+		if !containsStr(metrics, r.Metric) {
+			metrics = append(metrics, r.Metric)
+		}
+		cells[k][r.Metric] = append(cells[k][r.Metric], float64(r.Value))
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+	sort.Strings(metrics)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\n", strings.Join(rows, "\t"), strings.Join(metrics, "\t"))
+	for _, key := range keys {
+		line := append([]string(nil), key...)
+		for _, m := range metrics {
+			vs := cells[strings.Join(key, "\t")][m]
+			if len(vs) == 0 {
+				line = append(line, "-")
+				continue
+			}
+			if len(vs) == 1 {
+				// no standard deviation of a single record
+				line = append(line, fmt.Sprintf("%.6g ± - (1)", vs[0]))
+				continue
+			}
+			mean, std := stat.MeanStdDev(vs, nil)
+			line = append(line, fmt.Sprintf("%.6g ± %.2g (%d)", mean, std, len(vs)))
+		}
+		fmt.Fprintln(tw, strings.Join(line, "\t"))
+	}
+	return tw.Flush()
+}
+
+func field(r results.Record, name string) (string, bool) {
+	switch name {
+	case "model":
+		return r.Model, true
+	case "learner":
+		return r.Learner, true
+	case "train":
+		return strconv.Itoa(r.Train), true
+	case "test":
+		return strconv.Itoa(r.Test), true
+	case "cut":
+		return strconv.Itoa(r.Cut), true
+	case "version":
+		return r.Version, true
+	}
+	return "", false
+}
+
+// lessKey compares row keys field by field, numerically when both fields are integers
+func lessKey(a, b []string) bool {
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errx := strconv.Atoi(a[i])
+		y, erry := strconv.Atoi(b[i])
+		if errx == nil && erry == nil {
+			return x < y
+		}
+		return a[i] < b[i]
+	}
+	return false
+}
+
+func containsStr(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
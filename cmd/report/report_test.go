@@ -0,0 +1,46 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/britojr/exp-run/cmd/results"
+)
+
+func TestWriteTable(t *testing.T) {
+	rec := func(learner string, train int, metric string, v float64) results.Record {
+		return results.Record{Model: "asia", Learner: learner, Train: train, Metric: metric, Value: results.Value(v)}
+	}
+	rs := []results.Record{
+		rec("ml", 1000, "kl", 1),
+		rec("ml", 200, "kl", 2),
+		rec("ml", 1000, "kl", 3),
+		rec("em", 200, "hel", 0.5),
+		rec("ml", 200, "hel", 0.1),
+		rec("ml", 200, "hel", 0.3),
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, rs, []string{"learner", "train"}); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		got = append(got, strings.Fields(line))
+	}
+	// rows sorted by learner and numerically by train, metrics sorted by name
+	want := [][]string{
+		{"learner", "train", "hel", "kl"},
+		{"em", "200", "0.5", "±", "-", "(1)", "-"},
+		{"ml", "200", "0.2", "±", "0.14", "(2)", "2", "±", "-", "(1)"},
+		{"ml", "1000", "-", "2", "±", "1.4", "(2)"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("table:\n%v", buf.String())
+	}
+	for i := range want {
+		if strings.Join(got[i], " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %v: got %q, want %q", i, strings.Join(got[i], " "), strings.Join(want[i], " "))
+		}
+	}
+}
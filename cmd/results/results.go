@@ -0,0 +1,170 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// Version identifies the build of the tool, it can be set at build time with
+// -ldflags "-X github.com/britojr/exp-run/cmd/results.Version=$(git describe --always --dirty)"
+var Version = ""
+
+// Record is a single distance result of an experiment
+type Record struct {
+	Model   string    `json:"model"`
+	Learner string    `json:"learner"`
+	Metric  string    `json:"metric"`
+	Train   int       `json:"train"`
+	Test    int       `json:"test"`
+	Cut     int       `json:"cut"`
+	Value   Value     `json:"value"`
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"`
+}
+
+// Value is a float64 that keeps infinities and NaN when encoded in json
+type Value float64
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		f, err := strconv.ParseFloat(s, 64)
+		*v = Value(f)
+		return err
+	}
+	var f float64
+	err := json.Unmarshal(data, &f)
+	*v = Value(f)
+	return err
+}
+
+var csvHeader = []string{"model", "learner", "metric", "train", "test", "cut", "value", "time", "version"}
+
+// ToolVersion returns the build version, falling back to the vcs revision stamped by
+// go build, with a -dirty suffix if the tree had local modifications
+func ToolVersion() string {
+	if len(Version) != 0 {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return vcsVersion(info.Settings)
+	}
+	return "unknown"
+}
+
+func vcsVersion(settings []debug.BuildSetting) string {
+	rev, modified := "", false
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if len(rev) == 0 {
+		return "unknown"
+	}
+	if modified {
+		rev += "-dirty"
+	}
+	return rev
+}
+
+// Append appends the record to a results file, in csv format if the file has
+// a .csv extension or as a json line otherwise
+func Append(fname string, r Record) error {
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if filepath.Ext(fname) != ".csv" {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(data, '\n'))
+		return err
+	}
+	w := csv.NewWriter(f)
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		w.Write(csvHeader)
+	}
+	w.Write([]string{
+		r.Model, r.Learner, r.Metric, strconv.Itoa(r.Train), strconv.Itoa(r.Test), strconv.Itoa(r.Cut),
+		strconv.FormatFloat(float64(r.Value), 'g', -1, 64), r.Time.Format(time.RFC3339), r.Version,
+	})
+	w.Flush()
+	return w.Error()
+}
+
+// Read reads all records of a results file written by Append,
+// failing on the first malformed row
+func Read(fname string) (rs []Record, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if filepath.Ext(fname) != ".csv" {
+		dec := json.NewDecoder(f)
+		for {
+			var r Record
+			if err := dec.Decode(&r); err == io.EOF {
+				return rs, nil
+			} else if err != nil {
+				return nil, err
+			}
+			rs = append(rs, r)
+		}
+	}
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = len(csvHeader)
+	lines, err := cr.ReadAll()
+	if err != nil {
+		// the parse error gives the line of the malformed row
+		return nil, fmt.Errorf("%v: %v", fname, err)
+	}
+	for i, line := range lines {
+		if i == 0 {
+			continue
+		}
+		r := Record{Model: line[0], Learner: line[1], Metric: line[2], Version: line[8]}
+		if r.Train, err = strconv.Atoi(line[3]); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, i+1, err)
+		}
+		if r.Test, err = strconv.Atoi(line[4]); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, i+1, err)
+		}
+		if r.Cut, err = strconv.Atoi(line[5]); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, i+1, err)
+		}
+		var v float64
+		if v, err = strconv.ParseFloat(line[6], 64); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, i+1, err)
+		}
+		r.Value = Value(v)
+		if r.Time, err = time.Parse(time.RFC3339, line[7]); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, i+1, err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
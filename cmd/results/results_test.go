@@ -0,0 +1,93 @@
+package results
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	var rs []Record
+	for i, v := range []float64{0.25, math.Inf(1), math.Inf(-1), math.NaN(), -1e-300} {
+		rs = append(rs, Record{Model: "asia", Learner: "ml", Metric: "kl", Train: 100 * (i + 1), Test: 50,
+			Cut: i % 2, Value: Value(v), Time: now.Add(time.Duration(i) * time.Second), Version: "v1"})
+	}
+	for _, name := range []string{"res.csv", "res.jsonl"} {
+		fname := filepath.Join(dir, name)
+		for _, r := range rs {
+			if err := Append(fname, r); err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+		}
+		got, err := Read(fname)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if len(got) != len(rs) {
+			t.Fatalf("%v: read %v records, want %v", name, len(got), len(rs))
+		}
+		for i, r := range rs {
+			g, v, w := got[i], float64(got[i].Value), float64(r.Value)
+			if !(v == w || math.IsNaN(v) && math.IsNaN(w)) {
+				t.Errorf("%v: record %v: value %v, want %v", name, i, v, w)
+			}
+			g.Value, r.Value = 0, 0
+			if !g.Time.Equal(r.Time) {
+				t.Errorf("%v: record %v: time %v, want %v", name, i, g.Time, r.Time)
+			}
+			g.Time, r.Time = time.Time{}, time.Time{}
+			if g != r {
+				t.Errorf("%v: record %v: got %+v, want %+v", name, i, g, r)
+			}
+		}
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "res.csv")
+	r := Record{Model: "asia", Learner: "ml", Metric: "kl", Train: 100, Value: 0.5, Time: time.Now()}
+	if err := Append(fname, r); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("asia,ml,kl,100\n")
+	f.Close()
+	if _, err := Read(fname); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("want error on line 3, got %v", err)
+	}
+}
+
+func TestVCSVersion(t *testing.T) {
+	cases := []struct {
+		settings []debug.BuildSetting
+		want     string
+	}{
+		{[]debug.BuildSetting{{Key: "vcs.revision", Value: "abc"}, {Key: "vcs.modified", Value: "false"}}, "abc"},
+		{[]debug.BuildSetting{{Key: "vcs.revision", Value: "abc"}, {Key: "vcs.modified", Value: "true"}}, "abc-dirty"},
+		{[]debug.BuildSetting{{Key: "vcs.modified", Value: "true"}}, "unknown"},
+	}
+	for _, tt := range cases {
+		if got := vcsVersion(tt.settings); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
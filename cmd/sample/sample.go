@@ -1,25 +1,23 @@
 package sample
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
-	"path/filepath"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/britojr/bnutils/bif"
 	"github.com/britojr/exp-run/cmd"
-	"github.com/britojr/exp-run/cmd/convert"
 	"github.com/britojr/lkbn/vars"
-	"github.com/britojr/utl/cmdsh"
-	"github.com/britojr/utl/errchk"
-	"github.com/britojr/utl/ioutl"
 )
 
-var randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 var Cmd = &cmd.Command{}
 
 // const extensions
@@ -32,59 +30,130 @@ const (
 func init() {
 	Cmd.Name = "sample"
 	Cmd.Short = "sample data and header"
-	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ExitOnError)
-	Cmd.Run = func(cm *cmd.Command, args []string) {
-		bifFile := cm.Flag.String("m", "", "input model in bif format")
-		outFile := cm.Flag.String("o", "", "basename of file to write tr/te/va format")
-		nTrain := cm.Flag.Int("tr", 0, "number of samples for training set")
-		nTest := cm.Flag.Int("te", 0, "number of samples for testing set")
-		nValid := cm.Flag.Int("va", 0, "number of samples for validation set")
-		cm.Flag.Parse(args)
-		if len(*bifFile) == 0 || len(*outFile) == 0 || *nTrain+*nTest+*nValid == 0 {
-			log.Printf("error: missing arguments!\n")
-			cm.Flag.PrintDefaults()
-			return
+	Cmd.Long = `
+Sample draws training, testing and validation sets from a bif model,
+one comma separated line of states per sample, and writes the .schema
+and .hdr files of the variables. Samples are drawn by forward sampling,
+or by gibbs sampling conditioned on the first line of the evidence file.`
+	Cmd.Examples = []string{
+		"sample -m asia.bif -o asia -tr 500 -te 1000 -seed 7",
+		"sample -m asia.bif -o asia-ev -tr 500 -ev asia.ev -burnin 5000",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	bifFile := Cmd.Flag.String("m", "", "input model in bif format")
+	outFile := Cmd.Flag.String("o", "", "basename of file to write tr/te/va format")
+	nTrain := Cmd.Flag.Int("tr", 0, "number of samples for training set")
+	nTest := Cmd.Flag.Int("te", 0, "number of samples for testing set")
+	nValid := Cmd.Flag.Int("va", 0, "number of samples for validation set")
+	evFile := Cmd.Flag.String("ev", "", "evidence file (gibbs sampling conditioned on its first line)")
+	burnIn := Cmd.Flag.Int("burnin", 1000, "number of gibbs sweeps discarded before sampling")
+	seed := Cmd.Flag.Int64("seed", 0, "random seed (0 to use current time)")
+	Cmd.Required = []string{"m", "o"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if *nTrain+*nTest+*nValid == 0 {
+			return cmd.Usagef("no samples requested, set -tr, -te or -va")
 		}
-		Generate(*bifFile, *outFile, *nTrain, *nTest, *nValid)
+		return Generate(*bifFile, *outFile, *evFile, *nTrain, *nTest, *nValid, *burnIn, *seed)
 	}
 }
 
-func Generate(bifFile, outFile string, nTrain, nTest, nValid int) {
-	uaiFile := strings.TrimSuffix(bifFile, filepath.Ext(bifFile)) + ".uai"
-	convert.Convert(bifFile, uaiFile, convert.Bif2uai, "", "", 0.0)
-
-	runSample(uaiFile, outFile+cTrain, nTrain)
-	runSample(uaiFile, outFile+cTest, nTest)
-	runSample(uaiFile, outFile+cValid, nValid)
-
+// Generate samples train/test/valid sets from a bif model, using forward sampling
+// or gibbs sampling if an evidence file is given
+func Generate(bifFile, outFile, evFile string, nTrain, nTest, nValid, burnIn int, seed int64) error {
 	b, err := bif.ParseStruct(bifFile)
-	errchk.Check(err, "")
-	writeHeaders(b.Variables(), outFile)
+	if err != nil {
+		return err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("sampling with seed %v\n", seed)
+	s, err := newSampler(b, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return fmt.Errorf("%v: %v", bifFile, err)
+	}
+	if len(evFile) != 0 {
+		evid, err := readEvidence(evFile)
+		if err != nil {
+			return err
+		}
+		if err := s.setEvidence(evid); err != nil {
+			return fmt.Errorf("%v: %v", evFile, err)
+		}
+		s.burn(burnIn)
+	}
 
+	if err := writeSamples(s, outFile+cTrain, nTrain); err != nil {
+		return err
+	}
+	if err := writeSamples(s, outFile+cTest, nTest); err != nil {
+		return err
+	}
+	if err := writeSamples(s, outFile+cValid, nValid); err != nil {
+		return err
+	}
+	return writeHeaders(b.Variables(), outFile)
 }
 
-func runSample(mdName, outName string, nSamp int) {
+func writeSamples(s *sampler, outName string, nSamp int) error {
 	if nSamp <= 0 {
-		return
+		return nil
 	}
-	cmdsh.ExecPrint(fmt.Sprintf(
-		"example_gibbs %s %d %v",
-		mdName, nSamp, outName,
-	), 0)
+	log.Printf("creating %v\n", outName)
+	f, err := os.Create(outName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for i := 0; i < nSamp; i++ {
+		writeLine(w, s.next())
+	}
+	return w.Flush()
+}
+
+func writeLine(w io.Writer, state []int) {
+	line := make([]string, len(state))
+	for i, x := range state {
+		line[i] = strconv.Itoa(x)
+	}
+	fmt.Fprintln(w, strings.Join(line, ","))
 }
 
-func writeHeaders(vs vars.VarList, outFile string) {
+// readEvidence reads the first line of a file in q/ev format ('*' for unobserved)
+func readEvidence(fname string) (map[int]int, error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	evid := make(map[int]int)
+	scanner := bufio.NewScanner(r)
+	if scanner.Scan() {
+		for i, v := range strings.Split(scanner.Text(), ",") {
+			if v != "*" {
+				x, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", fname, err)
+				}
+				evid[i] = x
+			}
+		}
+	}
+	return evid, scanner.Err()
+}
+
+func writeHeaders(vs vars.VarList, outFile string) error {
 	cards, names, maxs := make([]string, len(vs)), make([]string, len(vs)), make([]string, len(vs))
 	for i, v := range vs {
 		cards[i] = strconv.Itoa(v.NState())
 		names[i] = v.Name()
 		maxs[i] = strconv.Itoa(v.NState() - 1)
 	}
-	f := ioutl.CreateFile(outFile + ".schema")
-	fmt.Fprintf(f, "%s\n", strings.Join(cards, ","))
-	f.Close()
-	fh := ioutl.CreateFile(outFile + ".hdr")
-	fmt.Fprintf(fh, "%s\n", strings.Join(names, ","))
-	fmt.Fprintf(fh, "%s\n", strings.Join(maxs, ","))
-	fh.Close()
+	schema := fmt.Sprintf("%s\n", strings.Join(cards, ","))
+	if err := ioutil.WriteFile(outFile+".schema", []byte(schema), 0644); err != nil {
+		return err
+	}
+	hdr := fmt.Sprintf("%s\n%s\n", strings.Join(names, ","), strings.Join(maxs, ","))
+	return ioutil.WriteFile(outFile+".hdr", []byte(hdr), 0644)
 }
@@ -0,0 +1,158 @@
+package sample
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/britojr/bnutils/bif"
+)
+
+const asiaBif = "../examples/asia.bif"
+
+// asia variables by id
+const (
+	asia = iota
+	tub
+	smoke
+	lung
+	bronc
+	either
+	xray
+	dysp
+)
+
+func newAsiaSampler(t *testing.T, seed int64) *sampler {
+	b, err := bif.ParseStruct(asiaBif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSampler(b, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGenerateSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	evFile := filepath.Join(dir, "asia.ev")
+	if err := ioutil.WriteFile(evFile, []byte("*,*,*,*,*,0,*,*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []string{"", evFile} {
+		a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		for _, out := range []string{a, b} {
+			if err := Generate(asiaBif, out, ev, 200, 100, 0, 10, 7); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, ext := range []string{cTrain, cTest} {
+			x, err := ioutil.ReadFile(a + ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			y, err := ioutil.ReadFile(b + ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(x) == 0 || !bytes.Equal(x, y) {
+				t.Errorf("evidence %q: %v files differ with the same seed", ev, ext)
+			}
+		}
+	}
+}
+
+func TestForwardFrequencies(t *testing.T) {
+	s := newAsiaSampler(t, 1)
+	n := 50000
+	counts := make([]float64, len(s.vs))
+	for i := 0; i < n; i++ {
+		for id, x := range s.next() {
+			if x == 0 {
+				counts[id]++
+			}
+		}
+	}
+	// marginal probabilities of the first state (yes) given by the asia cpts
+	want := map[int]float64{
+		asia:  0.01,
+		tub:   0.01*0.05 + 0.99*0.01,
+		smoke: 0.5,
+		lung:  0.5*0.1 + 0.5*0.01,
+		bronc: 0.5*0.6 + 0.5*0.3,
+	}
+	for id, p := range want {
+		if got := counts[id] / float64(n); math.Abs(got-p) > 0.01 {
+			t.Errorf("frequency of %v: got %v, want %v", s.vs[id].Name(), got, p)
+		}
+	}
+}
+
+func TestGibbsEvidence(t *testing.T) {
+	s := newAsiaSampler(t, 3)
+	// either=yes is impossible in the most likely prior state, tub=no and lung=no
+	evid := map[int]int{either: 0, xray: 1}
+	if err := s.setEvidence(evid); err != nil {
+		t.Fatal(err)
+	}
+	s.burn(10)
+	for i := 0; i < 2000; i++ {
+		state := s.next()
+		for id, x := range evid {
+			if state[id] != x {
+				t.Fatalf("sample %v: evidence column %v changed to %v", i, id, state[id])
+			}
+		}
+		if state[tub] == 1 && state[lung] == 1 {
+			t.Fatalf("sample %v: %v contradicts the evidence", i, state)
+		}
+	}
+	s = newAsiaSampler(t, 3)
+	if err := s.setEvidence(map[int]int{tub: 0, either: 1}); err == nil {
+		t.Errorf("want error on impossible evidence")
+	}
+	if err := s.setEvidence(map[int]int{asia: 2}); err == nil {
+		t.Errorf("want error on invalid evidence")
+	}
+}
+
+func TestCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bifFile := filepath.Join(dir, "cycle.bif")
+	content := `network unknown {
+}
+variable a {
+  type discrete [ 2 ] { yes, no };
+}
+variable b {
+  type discrete [ 2 ] { yes, no };
+}
+probability ( a | b ) {
+  (yes) 0.5, 0.5;
+  (no) 0.5, 0.5;
+}
+probability ( b | a ) {
+  (yes) 0.5, 0.5;
+  (no) 0.5, 0.5;
+}
+`
+	if err := ioutil.WriteFile(bifFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate(bifFile, filepath.Join(dir, "out"), "", 10, 0, 0, 0, 1); err == nil {
+		t.Errorf("want error sampling a network with a cycle")
+	}
+}
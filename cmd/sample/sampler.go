@@ -0,0 +1,202 @@
+package sample
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/britojr/bnutils/bif"
+	"github.com/britojr/lkbn/factor"
+	"github.com/britojr/lkbn/vars"
+)
+
+// sampler draws complete assignments from a bayesian network,
+// by ancestral sampling or, when evidence is set, by gibbs sampling
+type sampler struct {
+	rnd      *rand.Rand
+	vs       vars.VarList
+	cpts     []*factor.Factor
+	ord      []*vars.Var
+	children [][]*vars.Var
+	evid     map[int]int
+	state    []int
+}
+
+func newSampler(b *bif.Struct, rnd *rand.Rand) (*sampler, error) {
+	s := &sampler{rnd: rnd, vs: b.Variables()}
+	s.cpts = make([]*factor.Factor, len(s.vs))
+	s.children = make([][]*vars.Var, len(s.vs))
+	for _, v := range s.vs {
+		s.cpts[v.ID()] = b.Factor(v.Name())
+	}
+	for _, v := range s.vs {
+		for _, u := range s.cpts[v.ID()].Variables() {
+			if u.ID() != v.ID() {
+				s.children[u.ID()] = append(s.children[u.ID()], v)
+			}
+		}
+	}
+	var err error
+	if s.ord, err = s.topologicalOrder(); err != nil {
+		return nil, err
+	}
+	s.state = make([]int, len(s.vs))
+	return s, nil
+}
+
+// topologicalOrder returns the variables sorted so that parents come before children,
+// breaking ties by id to keep sampling reproducible
+func (s *sampler) topologicalOrder() ([]*vars.Var, error) {
+	indeg := make([]int, len(s.vs))
+	for _, v := range s.vs {
+		indeg[v.ID()] = len(s.cpts[v.ID()].Variables()) - 1
+	}
+	ord := make([]*vars.Var, 0, len(s.vs))
+	done := make([]bool, len(s.vs))
+	for len(ord) < len(s.vs) {
+		found := false
+		for _, v := range s.vs {
+			if done[v.ID()] || indeg[v.ID()] > 0 {
+				continue
+			}
+			done[v.ID()] = true
+			ord = append(ord, v)
+			for _, ch := range s.children[v.ID()] {
+				indeg[ch.ID()]--
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("network has a cycle")
+		}
+	}
+	return ord, nil
+}
+
+// maxInitTries is the number of forward samples tried to start a gibbs chain
+const maxInitTries = 10000
+
+// setEvidence fixes the observed variables and initializes the chain with a forward
+// sample, with the evidence clamped, of nonzero probability; a chain started from an
+// impossible state may never leave it when the cpts are deterministic
+func (s *sampler) setEvidence(evid map[int]int) error {
+	for v, x := range evid {
+		if v < 0 || v >= len(s.vs) || x < 0 || x >= s.vs[v].NState() {
+			return fmt.Errorf("invalid evidence %v=%v", v, x)
+		}
+	}
+	s.evid = evid
+	for i := 0; i < maxInitTries; i++ {
+		s.forward()
+		if s.joint() > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("no sample consistent with the evidence in %v tries", maxInitTries)
+}
+
+// joint returns the probability of the current state
+func (s *sampler) joint() float64 {
+	p := 1.0
+	for _, v := range s.vs {
+		p *= s.prob(v)
+	}
+	return p
+}
+
+// burn runs n gibbs sweeps discarding the samples
+func (s *sampler) burn(n int) {
+	for i := 0; i < n; i++ {
+		s.sweep()
+	}
+}
+
+// next returns a copy of the next sample
+func (s *sampler) next() []int {
+	if s.evid == nil {
+		s.forward()
+	} else {
+		s.sweep()
+	}
+	return append([]int(nil), s.state...)
+}
+
+// forward draws each variable from its cpt in topological order
+func (s *sampler) forward() {
+	for _, v := range s.ord {
+		if x, ok := s.evid[v.ID()]; ok {
+			s.state[v.ID()] = x
+			continue
+		}
+		s.state[v.ID()] = s.draw(s.condDist(v), 0)
+	}
+}
+
+// sweep resamples every unobserved variable given its markov blanket
+func (s *sampler) sweep() {
+	for _, v := range s.ord {
+		if _, ok := s.evid[v.ID()]; ok {
+			continue
+		}
+		cur := s.state[v.ID()]
+		dist := make([]float64, v.NState())
+		for k := range dist {
+			s.state[v.ID()] = k
+			dist[k] = s.prob(v)
+			for _, ch := range s.children[v.ID()] {
+				dist[k] *= s.prob(ch)
+			}
+		}
+		s.state[v.ID()] = s.draw(dist, cur)
+	}
+}
+
+// prob returns the cpt entry of v for the current state
+func (s *sampler) prob(v *vars.Var) float64 {
+	f := s.cpts[v.ID()]
+	idx, step := 0, 1
+	for _, u := range f.Variables() {
+		idx += s.state[u.ID()] * step
+		step *= u.NState()
+	}
+	return f.Values()[idx]
+}
+
+// condDist returns the distribution of v given the current state of its parents
+func (s *sampler) condDist(v *vars.Var) []float64 {
+	f := s.cpts[v.ID()]
+	base, stride, step := 0, 0, 1
+	for _, u := range f.Variables() {
+		if u.ID() == v.ID() {
+			stride = step
+		} else {
+			base += s.state[u.ID()] * step
+		}
+		step *= u.NState()
+	}
+	dist := make([]float64, v.NState())
+	for k := range dist {
+		dist[k] = f.Values()[base+k*stride]
+	}
+	return dist
+}
+
+// draw samples an index proportionally to the given weights,
+// returning dflt if all weights are zero
+func (s *sampler) draw(weights []float64, dflt int) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return dflt
+	}
+	r := s.rnd.Float64() * total
+	for k, w := range weights {
+		r -= w
+		if r < 0 {
+			return k
+		}
+	}
+	return len(weights) - 1
+}
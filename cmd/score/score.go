@@ -0,0 +1,255 @@
+package score
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/britojr/exp-run/cmd"
+	"github.com/britojr/exp-run/cmd/convert"
+	"github.com/britojr/exp-run/cmd/infkey"
+	"github.com/britojr/exp-run/cmd/pmlearn"
+	"github.com/britojr/lkbn/model"
+	"github.com/britojr/lkbn/vars"
+)
+
+var Cmd = &cmd.Command{}
+
+func init() {
+	Cmd.Name = "score"
+	Cmd.Short = "scores how well a model fits a dataset"
+	Cmd.Long = `
+Score computes the log-likelihood of each row of a complete dataset under a
+model (bif, xml or uai) and reports the total and average log-likelihood,
+the number of free parameters k, BIC, AIC and the BDeu score of the model
+structure with equivalent sample size -ess. All scores are on the log scale,
+higher is better: BIC = LL - k/2 log N and AIC = LL - k.
+The dataset columns are the variables of the header, matched to the model by
+name (or by position for schema files), or the model variables in order when
+no header is given. The per-row log-likelihoods are written in infkey format.`
+	Cmd.Examples = []string{
+		"score -m asia.bif -d asia.test -h asia.schema",
+		"score -m asia-learned.xml -d asia.test -h asia.schema -rows asia-learned.rows -ess 10",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	mFile := Cmd.Flag.String("m", "", "model file (bif|xml|uai)")
+	dsname := Cmd.Flag.String("d", "", "dataset file")
+	hdrname := Cmd.Flag.String("h", "", "header/schema file")
+	outFile := Cmd.Flag.String("o", "", "output file (default stdout)")
+	rowFile := Cmd.Flag.String("rows", "", "file to write the log-likelihood of each row")
+	ess := Cmd.Flag.Float64("ess", 1, "equivalent sample size of the bdeu score")
+	workers := Cmd.Flag.Int("workers", 1, "number of goroutines counting the dataset")
+	Cmd.Required = []string{"m", "d"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if *ess <= 0 {
+			return cmd.Usagef("invalid equivalent sample size: %v", *ess)
+		}
+		_, err := Score(*mFile, *dsname, *hdrname, *outFile, *rowFile, *ess, *workers)
+		return err
+	}
+}
+
+// Result is the fit of a model to a dataset
+type Result struct {
+	// N is the number of rows and Params the number of free parameters of the model
+	N, Params int
+	// LogLik is the total log-likelihood of the rows
+	LogLik float64
+	// BIC, AIC and BDeu are the penalized and bayesian scores
+	BIC, AIC, BDeu float64
+}
+
+// Score computes the log-likelihood of the rows of a dataset under a model, writing
+// them to rowFile if given, and writes the scores of the model to outFile or stdout
+func Score(mFile, dsname, hdrname, outFile, rowFile string, ess float64, workers int) (*Result, error) {
+	bn, err := convert.ReadBNet(mFile)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := columns(bn, hdrname)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := pmlearn.ReadDataset(dsname, cols)
+	if err != nil {
+		return nil, err
+	}
+	lls := rowLogLik(bn, ds)
+	res := &Result{N: ds.Len()}
+	zero := 0
+	for _, ll := range lls {
+		res.LogLik += ll
+		if math.IsInf(ll, -1) {
+			zero++
+		}
+	}
+	if zero > 0 {
+		log.Printf("warning: %v rows with zero probability\n", zero)
+	}
+	var families [][]*vars.Var
+	for _, v := range bn.Variables() {
+		families = append(families, bn.Node(v).Potential().Variables())
+	}
+	counts := ds.Count(families, workers)
+	for i, v := range bn.Variables() {
+		res.Params += Params(families[i], v)
+		res.BDeu += BDeu(counts[i], families[i], v, ess)
+	}
+	res.BIC = res.LogLik - float64(res.Params)/2*math.Log(float64(res.N))
+	res.AIC = res.LogLik - float64(res.Params)
+	if len(rowFile) != 0 {
+		if err := infkey.Write(rowFile, lls); err != nil {
+			return res, err
+		}
+	}
+	return res, writeResult(outFile, res)
+}
+
+// columns returns the model variables of the dataset columns, given by the header
+// or all the model variables in order
+func columns(bn *model.BNet, hdrname string) (vars.VarList, error) {
+	if len(hdrname) == 0 {
+		return bn.Variables(), nil
+	}
+	hs, err := convert.ParseHeader(hdrname)
+	if err != nil {
+		return nil, err
+	}
+	var cols vars.VarList
+	seen := make(map[int]bool)
+	for _, h := range hs {
+		v := bn.Variables().FindByName(h.Name())
+		if v == nil && h.Name() == strconv.Itoa(h.ID()) {
+			v = bn.Variables().FindByID(h.ID())
+		}
+		if v == nil {
+			return nil, fmt.Errorf("%v: variable %v is not in the model", hdrname, h.Name())
+		}
+		if v.NState() != h.NState() {
+			return nil, fmt.Errorf("%v: variable %v has %v states, the model has %v",
+				hdrname, h.Name(), h.NState(), v.NState())
+		}
+		if seen[v.ID()] {
+			return nil, fmt.Errorf("%v: repeated variable %v", hdrname, h.Name())
+		}
+		seen[v.ID()] = true
+		cols = append(cols, v)
+	}
+	for _, v := range bn.Variables() {
+		if !seen[v.ID()] {
+			return nil, fmt.Errorf("%v: model variable %v is not in the dataset", hdrname, v.Name())
+		}
+	}
+	return cols, nil
+}
+
+// rowLogLik returns the log-probability of each row of the dataset
+func rowLogLik(bn *model.BNet, ds *pmlearn.Dataset) []float64 {
+	lls := make([]float64, ds.Len())
+	for _, v := range bn.Variables() {
+		f := bn.Node(v).Potential()
+		var cols [][]int32
+		var strides []int
+		step := 1
+		for _, u := range f.Variables() {
+			cols, strides = append(cols, ds.Column(u.ID())), append(strides, step)
+			step *= u.NState()
+		}
+		values := f.Values()
+		for r := range lls {
+			k := 0
+			for j, col := range cols {
+				k += int(col[r]) * strides[j]
+			}
+			lls[r] += math.Log(values[k])
+		}
+	}
+	return lls
+}
+
+// Params returns the number of free parameters of the table of v over its family
+func Params(family []*vars.Var, v *vars.Var) int {
+	n := 1
+	for _, u := range family {
+		n *= u.NState()
+	}
+	return n / v.NState() * (v.NState() - 1)
+}
+
+// LogLik returns the log-likelihood of the counts of a family under
+// the maximum likelihood parameters
+func LogLik(counts []float64, family []*vars.Var, v *vars.Var) (ll float64) {
+	eachConfig(counts, family, v, func(nij float64, nijk []float64) {
+		for _, n := range nijk {
+			if n > 0 {
+				ll += n * math.Log(n/nij)
+			}
+		}
+	})
+	return
+}
+
+// BDeu returns the log of the bayesian dirichlet equivalent uniform score of the counts
+// of a family, with the equivalent sample size ess spread uniformly over the cells
+func BDeu(counts []float64, family []*vars.Var, v *vars.Var, ess float64) (s float64) {
+	aijk := ess / float64(len(counts))
+	aij := aijk * float64(v.NState())
+	eachConfig(counts, family, v, func(nij float64, nijk []float64) {
+		s += lgamma(aij) - lgamma(aij+nij)
+		for _, n := range nijk {
+			s += lgamma(aijk+n) - lgamma(aijk)
+		}
+	})
+	return
+}
+
+// eachConfig calls f with the total and the counts of the states of v
+// for each configuration of the parents of v
+func eachConfig(counts []float64, family []*vars.Var, v *vars.Var, f func(nij float64, nijk []float64)) {
+	stride := 1
+	for _, u := range family {
+		if u.ID() == v.ID() {
+			break
+		}
+		stride *= u.NState()
+	}
+	r := v.NState()
+	nijk := make([]float64, r)
+	for base := 0; base < len(counts); base += stride * r {
+		for off := base; off < base+stride; off++ {
+			nij := 0.0
+			for k := range nijk {
+				nijk[k] = counts[off+k*stride]
+				nij += nijk[k]
+			}
+			f(nij, nijk)
+		}
+	}
+}
+
+func lgamma(x float64) float64 {
+	y, _ := math.Lgamma(x)
+	return y
+}
+
+func writeResult(fname string, res *Result) error {
+	var w io.Writer = os.Stdout
+	if len(fname) != 0 {
+		f, err := os.Create(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "n\tloglik\tavg-loglik\tparams\tbic\taic\tbdeu")
+	fmt.Fprintf(tw, "%v\t%.6f\t%.6f\t%v\t%.6f\t%.6f\t%.6f\n", res.N, res.LogLik,
+		res.LogLik/float64(res.N), res.Params, res.BIC, res.AIC, res.BDeu)
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+package score
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/britojr/lkbn/vars"
+)
+
+func TestScore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mFile, dsname := filepath.Join(dir, "ab.bif"), filepath.Join(dir, "ab.test")
+	content := `network unknown {
+}
+variable a {
+  type discrete [ 2 ] { yes, no };
+}
+variable b {
+  type discrete [ 2 ] { yes, no };
+}
+probability ( a ) {
+  table 0.4, 0.6;
+}
+probability ( b | a ) {
+  (yes) 0.9, 0.1;
+  (no) 0.2, 0.8;
+}
+`
+	if err := ioutil.WriteFile(mFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dsname, []byte("0,0\n1,1\n1,0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Score(mFile, dsname, "", filepath.Join(dir, "ab.score"), "", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll := math.Log(.4*.9) + math.Log(.6*.8) + math.Log(.6*.2)
+	if res.N != 3 || res.Params != 3 || math.Abs(res.LogLik-ll) > 1e-9 {
+		t.Errorf("wrong result: %+v, want n=3 params=3 loglik=%v", res, ll)
+	}
+	if bic := ll - 1.5*math.Log(3); math.Abs(res.BIC-bic) > 1e-9 {
+		t.Errorf("wrong bic, want %v, got %v", bic, res.BIC)
+	}
+}
+
+func TestBDeu(t *testing.T) {
+	a, b := vars.New(0, 2, "a", false), vars.New(1, 2, "b", false)
+	// with ess 2 a root has a beta(1, 1) prior, the marginal likelihood of (3, 1) is 3!1!/5!
+	if got, want := BDeu([]float64{3, 1}, []*vars.Var{a}, a, 2), math.Log(6.0/120); math.Abs(got-want) > 1e-9 {
+		t.Errorf("wrong bdeu of a root, want %v, got %v", want, got)
+	}
+	// with ess 4 each parent configuration of b has a beta(1, 1) prior
+	counts := []float64{3, 0, 1, 2} // (a, b) = 00, 10, 01, 11
+	want := math.Log(6.0/120) + math.Log(2.0/6)
+	if got := BDeu(counts, []*vars.Var{a, b}, b, 4); math.Abs(got-want) > 1e-9 {
+		t.Errorf("wrong bdeu of a child, want %v, got %v", want, got)
+	}
+	want = 3*math.Log(3.0/4) + math.Log(1.0/4) + 2*math.Log(1)
+	if got := LogLik(counts, []*vars.Var{a, b}, b); math.Abs(got-want) > 1e-9 {
+		t.Errorf("wrong log-likelihood, want %v, got %v", want, got)
+	}
+}
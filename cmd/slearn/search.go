@@ -0,0 +1,331 @@
+package slearn
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/britojr/exp-run/cmd/pmlearn"
+	"github.com/britojr/exp-run/cmd/score"
+	"github.com/britojr/lkbn/vars"
+)
+
+// minGain is the smallest score improvement taken as better, below it differences
+// are rounding errors of the family scores
+const minGain = 1e-9
+
+// Search configures the structure search
+type Search struct {
+	// Score is the decomposable score maximized, bic or bdeu with equivalent sample size ESS
+	Score string
+	ESS   float64
+	// MaxParents limits the number of parents of each variable, if positive
+	MaxParents int
+	// Tabu is the size of the tabu list and the number of moves without a better
+	// structure before the search stops; zero is plain hill climbing
+	Tabu int
+	// Restarts is the number of searches from the best structure with Perturb random moves
+	Restarts, Perturb int
+	Seed              int64
+	Workers           int
+}
+
+// move operators
+const (
+	addArc = iota
+	delArc
+	revArc
+)
+
+// move adds, deletes or reverses the arc from u to v
+type move struct {
+	op, u, v int
+}
+
+// undo returns the move that reverts m
+func (m move) undo() move {
+	switch m.op {
+	case addArc:
+		return move{delArc, m.u, m.v}
+	case delArc:
+		return move{addArc, m.u, m.v}
+	}
+	return move{revArc, m.v, m.u}
+}
+
+// dag holds the parents of each variable, by position in the variable list
+type dag [][]int
+
+func (g dag) copy() dag {
+	h := make(dag, len(g))
+	for i, pa := range g {
+		h[i] = append([]int(nil), pa...)
+	}
+	return h
+}
+
+func (g dag) hasArc(u, v int) bool {
+	for _, p := range g[v] {
+		if p == u {
+			return true
+		}
+	}
+	return false
+}
+
+// reaches reports whether there is a directed path from u to v, ignoring the arc skip
+func (g dag) reaches(u, v int, skip [2]int) bool {
+	// search backwards from v through the parents
+	seen := make([]bool, len(g))
+	stack := []int{v}
+	for len(stack) > 0 {
+		w := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w == u {
+			return true
+		}
+		for _, p := range g[w] {
+			if !seen[p] && !(p == skip[0] && w == skip[1]) {
+				seen[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+	return false
+}
+
+func (g dag) apply(m move) {
+	switch m.op {
+	case addArc:
+		g[m.v] = withParent(g[m.v], m.u)
+	case delArc:
+		g[m.v] = withoutParent(g[m.v], m.u)
+	case revArc:
+		g[m.v] = withoutParent(g[m.v], m.u)
+		g[m.u] = withParent(g[m.u], m.v)
+	}
+}
+
+func withParent(pa []int, u int) []int {
+	pa = append(append([]int(nil), pa...), u)
+	sort.Ints(pa)
+	return pa
+}
+
+func withoutParent(pa []int, u int) (res []int) {
+	for _, p := range pa {
+		if p != u {
+			res = append(res, p)
+		}
+	}
+	return
+}
+
+// searcher scores families of a dataset, caching the score of each family
+type searcher struct {
+	Search
+	ds    *pmlearn.Dataset
+	vs    vars.VarList
+	cache map[string]float64
+}
+
+func familyKey(v int, pa []int) string {
+	return fmt.Sprint(v, pa)
+}
+
+// family returns the variables of v and its parents ordered by id
+func (s *searcher) family(v int, pa []int) []*vars.Var {
+	family := vars.VarList{s.vs[v]}
+	for _, p := range pa {
+		family.Add(s.vs[p])
+	}
+	return family
+}
+
+// prefetch scores in a single pass over the data the families not in the cache
+func (s *searcher) prefetch(vs []int, pas [][]int) {
+	var keys []string
+	var idx []int
+	var families [][]*vars.Var
+	pending := make(map[string]bool)
+	for i, v := range vs {
+		key := familyKey(v, pas[i])
+		if _, ok := s.cache[key]; ok || pending[key] {
+			continue
+		}
+		pending[key] = true
+		keys, idx = append(keys, key), append(idx, v)
+		families = append(families, s.family(v, pas[i]))
+	}
+	if len(families) == 0 {
+		return
+	}
+	counts := s.ds.Count(families, s.Workers)
+	for i, key := range keys {
+		v := s.vs[idx[i]]
+		switch s.Score {
+		case BDeu:
+			s.cache[key] = score.BDeu(counts[i], families[i], v, s.ESS)
+		default:
+			s.cache[key] = score.LogLik(counts[i], families[i], v) -
+				float64(score.Params(families[i], v))/2*math.Log(float64(s.ds.Len()))
+		}
+	}
+}
+
+func (s *searcher) score(v int, pa []int) float64 {
+	key := familyKey(v, pa)
+	if _, ok := s.cache[key]; !ok {
+		s.prefetch([]int{v}, [][]int{pa})
+	}
+	return s.cache[key]
+}
+
+func (s *searcher) total(g dag) (sc float64) {
+	vs := make([]int, len(g))
+	for v := range g {
+		vs[v] = v
+	}
+	s.prefetch(vs, g)
+	for v, pa := range g {
+		sc += s.score(v, pa)
+	}
+	return
+}
+
+// moves returns the valid moves from g, keeping the graph acyclic and the parent limit
+func (s *searcher) moves(g dag) (ms []move) {
+	full := func(v int) bool { return s.MaxParents > 0 && len(g[v]) >= s.MaxParents }
+	none := [2]int{-1, -1}
+	for v := range g {
+		for u := range g {
+			switch {
+			case u == v:
+			case g.hasArc(u, v):
+				ms = append(ms, move{delArc, u, v})
+				if !full(u) && !g.reaches(u, v, [2]int{u, v}) {
+					ms = append(ms, move{revArc, u, v})
+				}
+			case !g.hasArc(v, u) && !full(v) && !g.reaches(v, u, none):
+				ms = append(ms, move{addArc, u, v})
+			}
+		}
+	}
+	return
+}
+
+// gain returns the score difference of applying m to g
+func (s *searcher) gain(g dag, m move) float64 {
+	switch m.op {
+	case addArc:
+		return s.score(m.v, withParent(g[m.v], m.u)) - s.score(m.v, g[m.v])
+	case delArc:
+		return s.score(m.v, withoutParent(g[m.v], m.u)) - s.score(m.v, g[m.v])
+	}
+	return s.score(m.v, withoutParent(g[m.v], m.u)) - s.score(m.v, g[m.v]) +
+		s.score(m.u, withParent(g[m.u], m.v)) - s.score(m.u, g[m.u])
+}
+
+// prefetchMoves scores in a single pass the families changed by the moves
+func (s *searcher) prefetchMoves(g dag, ms []move) {
+	var vs []int
+	var pas [][]int
+	for _, m := range ms {
+		switch m.op {
+		case addArc:
+			vs, pas = append(vs, m.v), append(pas, withParent(g[m.v], m.u))
+		case delArc:
+			vs, pas = append(vs, m.v), append(pas, withoutParent(g[m.v], m.u))
+		case revArc:
+			vs, pas = append(vs, m.v, m.u), append(pas, withoutParent(g[m.v], m.u), withParent(g[m.u], m.v))
+		}
+	}
+	s.prefetch(vs, pas)
+}
+
+// climb applies the best move until no move improves the score or, in tabu search,
+// until Tabu moves pass without a better structure; it returns the best structure found
+func (s *searcher) climb(g dag) (dag, float64) {
+	g = g.copy()
+	cur := s.total(g)
+	best, bestScore := g.copy(), cur
+	var tabu []move
+	for stall := 0; ; {
+		ms := s.moves(g)
+		s.prefetchMoves(g, ms)
+		found, bestMove, bestGain := false, move{}, math.Inf(-1)
+		for _, m := range ms {
+			if isTabu(tabu, m) {
+				continue
+			}
+			if d := s.gain(g, m); d > bestGain {
+				found, bestMove, bestGain = true, m, d
+			}
+		}
+		if !found || (s.Tabu == 0 && bestGain <= minGain) {
+			break
+		}
+		g.apply(bestMove)
+		cur += bestGain
+		if s.Tabu > 0 {
+			tabu = append(tabu, bestMove.undo())
+			if len(tabu) > s.Tabu {
+				tabu = tabu[1:]
+			}
+		}
+		if cur > bestScore+minGain {
+			best, bestScore, stall = g.copy(), cur, 0
+		} else if stall++; stall >= s.Tabu {
+			break
+		}
+	}
+	return best, bestScore
+}
+
+func isTabu(tabu []move, m move) bool {
+	for _, t := range tabu {
+		if t == m {
+			return true
+		}
+	}
+	return false
+}
+
+// perturb applies n random valid moves to g
+func (s *searcher) perturb(g dag, n int, rnd *rand.Rand) dag {
+	g = g.copy()
+	for i := 0; i < n; i++ {
+		ms := s.moves(g)
+		if len(ms) == 0 {
+			break
+		}
+		g.apply(ms[rnd.Intn(len(ms))])
+	}
+	return g
+}
+
+// Run searches the structure of the dataset from the empty graph, returning
+// the positions of the parents of each variable and the score of the structure
+func (sr Search) Run(ds *pmlearn.Dataset) ([][]int, float64) {
+	s := &searcher{Search: sr, ds: ds, vs: ds.Variables(), cache: make(map[string]float64)}
+	rnd := rand.New(rand.NewSource(sr.Seed))
+	best, bestScore := s.climb(make(dag, len(s.vs)))
+	log.Printf("start: score %v, %v arcs\n", bestScore, arcs(best))
+	for r := 1; r <= sr.Restarts; r++ {
+		g, sc := s.climb(s.perturb(best, sr.Perturb, rnd))
+		log.Printf("restart %v: score %v, %v arcs\n", r, sc, arcs(g))
+		if sc > bestScore+minGain {
+			best, bestScore = g, sc
+		}
+	}
+	return best, bestScore
+}
+
+func arcs(g dag) (n int) {
+	for _, pa := range g {
+		n += len(pa)
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package slearn
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/britojr/exp-run/cmd"
+	"github.com/britojr/exp-run/cmd/convert"
+	"github.com/britojr/exp-run/cmd/pmlearn"
+	"github.com/britojr/lkbn/vars"
+)
+
+// score options
+const (
+	BIC  = "bic"
+	BDeu = "bdeu"
+)
+
+var Cmd = &cmd.Command{}
+
+func init() {
+	Cmd.Name = "slearn"
+	Cmd.Short = "structure learning with complete data"
+	Cmd.Long = `
+Slearn searches the structure of a bayesian network that maximizes the bic or
+bdeu score of a dataset, by hill climbing over arc additions, deletions and
+reversals from the empty graph. With -tabu the search goes on through moves
+that do not improve the score, forbidding the undoing of the last moves, until
+that many moves pass without a better structure. Each restart perturbs the best
+structure with random moves and climbs again.
+The structure is written in list of parents format ("name: parent,parent"),
+one line per variable in the order of the dataset columns, as read by pmlearn.`
+	Cmd.Examples = []string{
+		"slearn -d asia.train -h asia.schema -o asia.parents",
+		"slearn -d asia.train -h asia.schema -o asia.parents -score bdeu -ess 10 -maxpa 2 -tabu 20 -restarts 5",
+	}
+	Cmd.Flag = flag.NewFlagSet(Cmd.Name, flag.ContinueOnError)
+	dsname := Cmd.Flag.String("d", "", "dataset file")
+	hdrname := Cmd.Flag.String("h", "", "header/schema file")
+	dst := Cmd.Flag.String("o", "", "output file (in list of parents format)")
+	var s Search
+	Cmd.Flag.StringVar(&s.Score, "score", BIC, "score {"+BIC+"|"+BDeu+"}")
+	Cmd.Flag.Float64Var(&s.ESS, "ess", 1, "equivalent sample size of the bdeu score")
+	Cmd.Flag.IntVar(&s.MaxParents, "maxpa", 0, "maximum number of parents of a variable (0 for no limit)")
+	Cmd.Flag.IntVar(&s.Tabu, "tabu", 0, "tabu list size and moves without improvement (0 for hill climbing)")
+	Cmd.Flag.IntVar(&s.Restarts, "restarts", 0, "number of random restarts")
+	Cmd.Flag.IntVar(&s.Perturb, "perturb", 10, "number of random moves of each restart")
+	Cmd.Flag.Int64Var(&s.Seed, "seed", 0, "random seed (0 to use current time)")
+	Cmd.Flag.IntVar(&s.Workers, "workers", 1, "number of goroutines counting the dataset")
+	Cmd.Required = []string{"d", "o"}
+	Cmd.Run = func(cm *cmd.Command, args []string) error {
+		if s.Score != BIC && s.Score != BDeu {
+			return cmd.Usagef("invalid score option: (%v)", s.Score)
+		}
+		if s.ESS <= 0 || s.MaxParents < 0 || s.Tabu < 0 || s.Restarts < 0 || s.Perturb < 0 {
+			return cmd.Usagef("invalid search options")
+		}
+		return StructLearn(*dsname, *hdrname, *dst, s)
+	}
+}
+
+// StructLearn searches the structure of the dataset and writes it in list of parents format
+func StructLearn(dsname, hdrname, outFile string, s Search) error {
+	var vs vars.VarList
+	if len(hdrname) != 0 {
+		var err error
+		if vs, err = convert.ParseHeader(hdrname); err != nil {
+			return err
+		}
+	}
+	ds, err := pmlearn.ReadDataset(dsname, vs)
+	if err != nil {
+		return err
+	}
+	if s.Seed == 0 {
+		s.Seed = time.Now().UnixNano()
+	}
+	log.Printf("searching %v structure of %v variables with seed %v\n", s.Score, len(ds.Variables()), s.Seed)
+	pa, sc := s.Run(ds)
+	log.Printf("best %v score: %v\n", s.Score, sc)
+	log.Printf("writing %v\n", outFile)
+	return writeParents(outFile, ds.Variables(), pa)
+}
+
+// writeParents writes a line "name: parent,parent" for each variable,
+// with pa the positions of the parents of each variable in vs
+func writeParents(fname string, vs vars.VarList, pa [][]int) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for i, v := range vs {
+		names := make([]string, len(pa[i]))
+		for j, p := range pa[i] {
+			names[j] = vs[p].Name()
+		}
+		fmt.Fprintln(w, strings.TrimSpace(v.Name()+": "+strings.Join(names, ",")))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,78 @@
+package slearn
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/britojr/exp-run/cmd/pmlearn"
+	"github.com/britojr/lkbn/vars"
+)
+
+// chainDataset samples a -> b -> c, each variable copying its parent with probability .9
+func chainDataset(n int) *pmlearn.Dataset {
+	rnd := rand.New(rand.NewSource(3))
+	vs := vars.VarList{vars.New(0, 2, "a", false), vars.New(1, 2, "b", false), vars.New(2, 2, "c", false)}
+	noisy := func(x int) int {
+		if rnd.Float64() < .9 {
+			return x
+		}
+		return 1 - x
+	}
+	rows := make([]map[int]int, n)
+	for i := range rows {
+		a := rnd.Intn(2)
+		b := noisy(a)
+		rows[i] = map[int]int{0: a, 1: b, 2: noisy(b)}
+	}
+	return pmlearn.NewDataset(vs, rows)
+}
+
+func TestRun(t *testing.T) {
+	ds := chainDataset(2000)
+	cases := []Search{
+		{Score: BIC, Workers: 1},
+		{Score: BDeu, ESS: 1, Workers: 2},
+		{Score: BIC, Tabu: 5, Restarts: 2, Perturb: 3, Seed: 1, Workers: 1},
+	}
+	for _, s := range cases {
+		pa, _ := s.Run(ds)
+		g := dag(pa)
+		adj := func(u, v int) bool { return g.hasArc(u, v) || g.hasArc(v, u) }
+		if !adj(0, 1) || !adj(1, 2) || adj(0, 2) {
+			t.Errorf("%+v: wrong skeleton of the chain: %v", s, pa)
+		}
+		// a and c are independent given b, so the chain cannot be a v-structure
+		if g.hasArc(0, 1) && g.hasArc(2, 1) {
+			t.Errorf("%+v: wrong v-structure: %v", s, pa)
+		}
+	}
+	pa, _ := Search{Score: BIC, MaxParents: 1, Workers: 1}.Run(ds)
+	for v := range pa {
+		if len(pa[v]) > 1 {
+			t.Errorf("more than one parent of %v: %v", v, pa)
+		}
+	}
+}
+
+func TestWriteParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slearn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "chain.parents")
+	vs := vars.VarList{vars.New(0, 2, "a", false), vars.New(1, 2, "b", false), vars.New(2, 2, "c", false)}
+	if err := writeParents(fname, vs, [][]int{nil, {0}, {0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a:\nb: a\nc: a,b\n"; string(got) != want {
+		t.Errorf("wrong parents file, want:\n%q\ngot:\n%q", want, got)
+	}
+}